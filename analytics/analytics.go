@@ -0,0 +1,235 @@
+// Package analytics records sponsor impressions and clicks and rolls them up
+// into daily statistics for reporting.
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var botPatterns = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "embedly",
+	"preview", "headless", "lighthouse", "curl/", "wget", "python-requests",
+	"go-http-client", "httpclient", "okhttp", "monitor",
+}
+
+// IsBot reports whether the User-Agent looks automated. An empty UA counts
+// as a bot since every browser sends one.
+func IsBot(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return true
+	}
+	for _, p := range botPatterns {
+		if strings.Contains(ua, p) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	saltOnce sync.Once
+	salt     []byte
+)
+
+// ipSalt is ANALYTICS_IP_SALT, or a random per-process secret when unset
+// (unique-click counts then reset on restart)
+func ipSalt() []byte {
+	saltOnce.Do(func() {
+		if s := os.Getenv("ANALYTICS_IP_SALT"); s != "" {
+			salt = []byte(s)
+			return
+		}
+		salt = make([]byte, 32)
+		rand.Read(salt)
+		slog.Warn("ANALYTICS_IP_SALT is not set, using a random salt")
+	})
+	return salt
+}
+
+// HashIP pseudonymises ip. The day is mixed in so hashes can't be linked
+// across days.
+func HashIP(ip string, now time.Time) string {
+	mac := hmac.New(sha256.New, ipSalt())
+	mac.Write([]byte(now.Format("2006-01-02") + "|" + ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// day truncates t to midnight in its location
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// RecordImpressions counts one impression for each sponsor on today's row
+func RecordImpressions(sponsorIDs []uint, isBot bool, now time.Time) error {
+	column := "impressions"
+	if isBot {
+		column = "bot_impressions"
+	}
+
+	rows := make([]models.SponsorDailyStat, 0, len(sponsorIDs))
+	for _, id := range sponsorIDs {
+		stat := models.SponsorDailyStat{SponsorID: id, Date: day(now)}
+		if isBot {
+			stat.BotImpressions = 1
+		} else {
+			stat.Impressions = 1
+		}
+		rows = append(rows, stat)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "sponsor_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			column:       gorm.Expr(column + " + 1"),
+			"updated_at": now,
+		}),
+	}).Create(&rows).Error
+}
+
+// RecordClick stores a click
+func RecordClick(click *models.SponsorClick) error {
+	if len(click.Referrer) > 512 {
+		click.Referrer = click.Referrer[:512]
+	}
+	if len(click.UserAgent) > 512 {
+		click.UserAgent = click.UserAgent[:512]
+	}
+	return config.DB.Create(click).Error
+}
+
+// RollupDay rebuilds the click columns of the daily stats for the day
+// containing t from the raw clicks. It is idempotent.
+func RollupDay(t time.Time) error {
+	start := day(t)
+	end := start.AddDate(0, 0, 1)
+
+	var rows []struct {
+		SponsorID    uint
+		Clicks       int64
+		UniqueClicks int64
+		BotClicks    int64
+	}
+	err := config.DB.Model(&models.SponsorClick{}).
+		Select("sponsor_id, "+
+			"SUM(CASE WHEN is_bot THEN 0 ELSE 1 END) AS clicks, "+
+			"COUNT(DISTINCT CASE WHEN is_bot THEN NULL ELSE ip_hash END) AS unique_clicks, "+
+			"SUM(CASE WHEN is_bot THEN 1 ELSE 0 END) AS bot_clicks").
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Group("sponsor_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	stats := make([]models.SponsorDailyStat, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, models.SponsorDailyStat{
+			SponsorID:    row.SponsorID,
+			Date:         start,
+			Clicks:       row.Clicks,
+			UniqueClicks: row.UniqueClicks,
+			BotClicks:    row.BotClicks,
+		})
+	}
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sponsor_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"clicks", "unique_clicks", "bot_clicks", "updated_at"}),
+	}).Create(&stats).Error
+}
+
+// StartRollups rolls up yesterday and today every interval, so yesterday's
+// late clicks are included once the day is over
+func StartRollups(interval time.Duration) {
+	run := func() {
+		now := time.Now()
+		for _, t := range []time.Time{now.AddDate(0, 0, -1), now} {
+			if err := RollupDay(t); err != nil {
+				slog.Error("Sponsor stats rollup failed", "day", day(t).Format("2006-01-02"), "error", err)
+			}
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
+
+// SponsorReport is one sponsor's totals over a date range
+type SponsorReport struct {
+	SponsorID      uint    `json:"sponsor_id"`
+	Name           string  `json:"name"`
+	Slot           string  `json:"slot"`
+	Impressions    int64   `json:"impressions"`
+	Clicks         int64   `json:"clicks"`
+	UniqueClicks   int64   `json:"unique_clicks"`
+	BotImpressions int64   `json:"bot_impressions"`
+	BotClicks      int64   `json:"bot_clicks"`
+	CTR            float64 `json:"ctr"` // clicks / impressions, as a percentage
+}
+
+// Report totals each sponsor's stats for the days from..to inclusive.
+// sponsorID 0 reports every sponsor.
+func Report(from, to time.Time, sponsorID uint) ([]SponsorReport, error) {
+	var report []SponsorReport
+	db := config.DB.Table("sponsor_daily_stats AS s").
+		Select("s.sponsor_id, sp.name, sp.slot, "+
+			"SUM(s.impressions) AS impressions, SUM(s.clicks) AS clicks, SUM(s.unique_clicks) AS unique_clicks, "+
+			"SUM(s.bot_impressions) AS bot_impressions, SUM(s.bot_clicks) AS bot_clicks").
+		Joins("LEFT JOIN sponsors AS sp ON sp.id = s.sponsor_id").
+		Where("s.date >= ? AND s.date <= ?", day(from), day(to))
+	if sponsorID != 0 {
+		db = db.Where("s.sponsor_id = ?", sponsorID)
+	}
+	err := db.Group("s.sponsor_id, sp.name, sp.slot").
+		Order("s.sponsor_id").
+		Scan(&report).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report {
+		if report[i].Impressions > 0 {
+			report[i].CTR = float64(report[i].Clicks) / float64(report[i].Impressions) * 100
+		}
+	}
+	return report, nil
+}
+
+// Daily returns the per-day rows for the range, for charts and CSV export
+func Daily(from, to time.Time, sponsorID uint) ([]models.SponsorDailyStat, error) {
+	var stats []models.SponsorDailyStat
+	db := config.DB.Where("date >= ? AND date <= ?", day(from), day(to))
+	if sponsorID != 0 {
+		db = db.Where("sponsor_id = ?", sponsorID)
+	}
+	err := db.Order("date ASC, sponsor_id ASC").Find(&stats).Error
+	return stats, err
+}
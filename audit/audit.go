@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"wwb99/config"
+	"wwb99/logger"
+	"wwb99/models"
+	"wwb99/utils"
+)
+
+// Change is one field's old and new value in a diff
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// toMap converts a model to its JSON representation so only exported,
+// non-secret (json:"-") fields are recorded
+func toMap(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	return m
+}
+
+// Diff returns the fields that differ between before and after
+func Diff(before, after any) map[string]Change {
+	b, a := toMap(before), toMap(after)
+
+	keys := map[string]bool{}
+	for k := range b {
+		keys[k] = true
+	}
+	for k := range a {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	diff := map[string]Change{}
+	for _, k := range sorted {
+		if !reflect.DeepEqual(b[k], a[k]) {
+			diff[k] = Change{From: b[k], To: a[k]}
+		}
+	}
+	return diff
+}
+
+func marshal(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Record appends an audit entry for a mutation made by the current request.
+// before is nil for creations and after is nil for deletions. Failures are
+// logged rather than failing the request.
+func Record(r *http.Request, action, resourceType string, resourceID any, before, after any) {
+	entry := models.AuditLog{
+		ActorType:    "anonymous",
+		IP:           utils.ClientIP(r),
+		UserAgent:    r.UserAgent(),
+		RequestID:    logger.RequestID(r.Context()),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   fmt.Sprint(resourceID),
+		Before:       marshal(before),
+		After:        marshal(after),
+		Diff:         marshal(Diff(before, after)),
+	}
+	if len(entry.UserAgent) > 512 {
+		entry.UserAgent = entry.UserAgent[:512]
+	}
+
+	// Keep the request logger for SQL logs, but write the entry even if the
+	// client has gone away
+	db := config.DB.WithContext(context.WithoutCancel(r.Context()))
+
+	if apiKey, ok := r.Context().Value("api_key").(*models.APIKey); ok {
+		entry.ActorType = "api_key"
+		entry.ActorID = apiKey.ID
+		entry.ActorName = apiKey.Name + " (" + apiKey.Prefix + ")"
+	} else if userID, ok := r.Context().Value("user_id").(uint); ok {
+		entry.ActorType = "user"
+		entry.ActorID = userID
+		var user models.User
+		if db.Select("id", "username").First(&user, userID).Error == nil {
+			entry.ActorName = user.Username
+		}
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		logger.FromContext(r.Context()).Error("failed to write audit log",
+			"action", action, "resource_type", resourceType, "resource_id", entry.ResourceID, "error", err)
+	}
+}
@@ -2,9 +2,12 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"wwb99/logger"
+	"wwb99/metrics"
+
 	"github.com/joho/godotenv"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -12,14 +15,16 @@ import (
 
 var DB *gorm.DB
 
-func Connect() {
-	// Load .env only in development
+// LoadEnv loads .env only in development
+func LoadEnv() {
 	if os.Getenv("RAILWAY_ENVIRONMENT") == "" {
 		if err := godotenv.Load(); err != nil {
-			log.Println("No .env file found, continuing...")
+			slog.Info("No .env file found, continuing...")
 		}
 	}
+}
 
+func Connect() {
 	// Read environment variables
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASS")
@@ -33,7 +38,8 @@ func Connect() {
 
 	// Validate required variables
 	if dbUser == "" || dbPass == "" || dbHost == "" || dbName == "" {
-		log.Fatal("Missing one or more required database environment variables")
+		slog.Error("Missing one or more required database environment variables")
+		os.Exit(1)
 	}
 
 	// MySQL DSN string
@@ -41,11 +47,18 @@ func Connect() {
 		dbUser, dbPass, dbHost, dbPort, dbName)
 
 	// Connect using GORM
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.NewGormLogger(),
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		slog.Warn("Failed to register GORM metrics", "error", err)
 	}
 
 	DB = db
-	log.Println("✅ Database connected successfully")
+	slog.Info("Database connected", "host", dbHost, "database", dbName)
 }
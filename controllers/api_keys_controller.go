@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/audit"
+	"wwb99/models"
+	"wwb99/security"
+)
+
+// GetAPIKeys lists API keys (never the secret) with their permissions
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	var keys []models.APIKey
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset := (page - 1) * limit
+	db := requestDB(r).Model(&models.APIKey{})
+
+	if search := r.URL.Query().Get("search"); search != "" {
+		like := "%" + search + "%"
+		db = db.Where("name LIKE ? OR prefix LIKE ?", like, like)
+	}
+	if r.URL.Query().Get("active") == "true" {
+		db = db.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	}
+
+	var total int64
+	db.Count(&total)
+
+	result := db.Preload("Permissions").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&keys)
+
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":       keys,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateAPIKey issues a new key. The plaintext key is only returned here.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string     `json:"name"`
+		Permissions []uint     `json:"permissions"` // permission IDs
+		AllowedIPs  []string   `json:"allowed_ips"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	allowedIPs, err := security.ParseAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var permissions []models.Permission
+	if len(req.Permissions) > 0 {
+		if err := requestDB(r).Where("id IN ?", req.Permissions).Find(&permissions).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(permissions) != len(req.Permissions) {
+			http.Error(w, "One or more permissions do not exist", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A key can't carry more than its creator holds. Wildcards are compared
+	// as names, so "news.*" needs a "news.*" or "*" grant.
+	roleID, _ := r.Context().Value("role_id").(uint)
+	for _, p := range permissions {
+		if !security.RoleHasPermission(roleID, p.Name) {
+			http.Error(w, "You do not hold permission "+p.Name, http.StatusForbidden)
+			return
+		}
+	}
+
+	key, prefix, hash, err := security.GenerateAPIKey()
+	if err != nil {
+		http.Error(w, "Failed to generate key", http.StatusInternalServerError)
+		return
+	}
+
+	createdBy, _ := r.Context().Value("user_id").(uint)
+	apiKey := models.APIKey{
+		Name:        req.Name,
+		Prefix:      prefix,
+		KeyHash:     hash,
+		Permissions: permissions,
+		AllowedIPs:  allowedIPs,
+		ExpiresAt:   req.ExpiresAt,
+		CreatedBy:   createdBy,
+	}
+	if err := requestDB(r).Create(&apiKey).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "create", "api_key", apiKey.ID, nil, apiKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "API key created successfully. Store the key now, it will not be shown again.",
+		"data":    apiKey,
+		"key":     key,
+	})
+}
+
+// RevokeAPIKey handles DELETE /api/api-keys?id=
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing API key ID", http.StatusBadRequest)
+		return
+	}
+
+	result := requestDB(r).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	}
+	audit.Record(r, "revoke", "api_key", id, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked successfully"})
+}
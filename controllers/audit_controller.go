@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/models"
+
+	"gorm.io/gorm"
+)
+
+// auditQuery applies the filters shared by the audit list and export endpoints
+func auditQuery(r *http.Request) (*gorm.DB, error) {
+	q := r.URL.Query()
+	db := requestDB(r).Model(&models.AuditLog{})
+
+	if v := q.Get("actor_id"); v != "" {
+		db = db.Where("actor_id = ?", v)
+	}
+	if v := q.Get("actor_type"); v != "" {
+		db = db.Where("actor_type = ?", v)
+	}
+	if v := q.Get("action"); v != "" {
+		db = db.Where("action = ?", v)
+	}
+	if v := q.Get("resource_type"); v != "" {
+		db = db.Where("resource_type = ?", v)
+	}
+	if v := q.Get("resource_id"); v != "" {
+		db = db.Where("resource_id = ?", v)
+	}
+	if v := q.Get("ip"); v != "" {
+		db = db.Where("ip = ?", v)
+	}
+	if v := q.Get("from"); v != "" {
+		from, err := parseDateParam(v)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("created_at >= ?", from)
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := parseDateParam(v)
+		if err != nil {
+			return nil, err
+		}
+		// A bare date includes the whole day
+		if len(v) == len("2006-01-02") {
+			to = to.Add(24 * time.Hour)
+		}
+		db = db.Where("created_at < ?", to)
+	}
+	return db, nil
+}
+
+// parseDateParam accepts YYYY-MM-DD or RFC 3339
+func parseDateParam(v string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// GetAuditLogs returns the paginated, filterable audit log
+func GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	var logs []models.AuditLog
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset := (page - 1) * limit
+	db, err := auditQuery(r)
+	if err != nil {
+		http.Error(w, "Invalid date filter, use YYYY-MM-DD or RFC 3339", http.StatusBadRequest)
+		return
+	}
+
+	var total int64
+	db.Count(&total)
+
+	result := db.Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&logs)
+
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":       logs,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportAuditLogs streams the filtered audit log as CSV
+func ExportAuditLogs(w http.ResponseWriter, r *http.Request) {
+	db, err := auditQuery(r)
+	if err != nil {
+		http.Error(w, "Invalid date filter, use YYYY-MM-DD or RFC 3339", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Order("id ASC").Rows()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	filename := "audit-" + time.Now().Format("20060102-150405") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := csv.NewWriter(w)
+	err = cw.Write([]string{
+		"id", "created_at", "actor_type", "actor_id", "actor_name", "ip", "request_id",
+		"action", "resource_type", "resource_id", "diff", "before", "after",
+	})
+	if err != nil {
+		abortExport(r, err)
+	}
+
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := requestDB(r).ScanRows(rows, &entry); err != nil {
+			abortExport(r, err)
+		}
+		err := cw.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.Format(time.RFC3339),
+			entry.ActorType,
+			strconv.FormatUint(uint64(entry.ActorID), 10),
+			csvSafe(entry.ActorName),
+			entry.IP,
+			entry.RequestID,
+			entry.Action,
+			entry.ResourceType,
+			entry.ResourceID,
+			csvSafe(entry.Diff),
+			csvSafe(entry.Before),
+			csvSafe(entry.After),
+		})
+		if err != nil {
+			abortExport(r, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(r, err)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		abortExport(r, err)
+	}
+}
+
+// csvSafe neutralises values a spreadsheet would evaluate as a formula. A
+// value that already looks escaped gets another quote, so csvUnescape can
+// tell the two apart.
+func csvSafe(s string) string {
+	t := strings.TrimLeft(s, "'")
+	if t != "" && (t[0] == '=' || t[0] == '+' || t[0] == '-' || t[0] == '@') {
+		return "'" + s
+	}
+	return s
+}
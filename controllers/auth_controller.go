@@ -2,62 +2,193 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
-	"wwb99/config"
+	"os"
+	"strconv"
+	"wwb99/logger"
+	"wwb99/metrics"
 	"wwb99/models"
+	"wwb99/security"
 	"wwb99/utils"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Register is the public self-registration endpoint. It is disabled unless
+// ALLOW_REGISTRATION=true; accounts are normally created via invitations.
+// Self-registered users always get the DEFAULT_ROLE (default "user").
 func Register(w http.ResponseWriter, r *http.Request) {
+	if os.Getenv("ALLOW_REGISTRATION") != "true" {
+		http.Error(w, "Registration is disabled, ask an administrator for an invitation", http.StatusForbidden)
+		return
+	}
+
 	var user models.User
-	json.NewDecoder(r.Body).Decode(&user)
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := security.ValidatePassword(user.Password, user.Username); err != nil {
+		writePasswordPolicyError(w, err)
+		return
+	}
+
+	roleName := os.Getenv("DEFAULT_ROLE")
+	if roleName == "" {
+		roleName = "user"
+	}
+	var role models.Role
+	if err := requestDB(r).Where("name = ?", roleName).First(&role).Error; err != nil {
+		http.Error(w, "Default role is not configured", http.StatusInternalServerError)
+		return
+	}
 
 	hashed, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	user.Password = string(hashed)
+	newUser := models.User{
+		Username: user.Username,
+		Email:    user.Email,
+		Password: string(hashed),
+		RoleID:   role.ID,
+	}
 
-	// Assign default role (ID = 1)
-	user.RoleID = 1
+	if err := requestDB(r).Create(&newUser).Error; err != nil {
+		http.Error(w, "Failed to create user", http.StatusBadRequest)
+		return
+	}
 
-	config.DB.Create(&user)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       newUser.ID,
+		"username": newUser.Username,
+		"email":    newUser.Email,
+		"role":     role.Name,
+	})
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
 	var input models.User
-	json.NewDecoder(r.Body).Decode(&input)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
 
-	var user models.User
-	config.DB.Preload("Role.Permissions").Where("username = ?", input.Username).First(&user)
+	ip := utils.ClientIP(r)
+	userAgent := r.UserAgent()
+	log := logger.FromContext(r.Context())
+
+	attempt, err := security.ReserveLogin(ip, input.Username)
+	if err != nil {
+		var blocked *security.LoginBlockedError
+		if errors.As(err, &blocked) {
+			metrics.LoginAttemptsTotal.WithLabelValues("blocked").Inc()
+			security.LogLoginAttempt(input.Username, ip, userAgent, false, "throttled")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+			http.Error(w, blocked.Error(), http.StatusTooManyRequests)
+			return
+		}
+		log.Error("login throttle check failed", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
+	var user models.User
+	err = requestDB(r).Preload("Role.Permissions").Where("username = ?", input.Username).First(&user).Error
+	if err == nil {
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
+	} else {
+		// Unknown username: still pay the bcrypt cost
+		security.CompareDummyPassword(input.Password)
+	}
 	if err != nil {
+		metrics.LoginAttemptsTotal.WithLabelValues("failure").Inc()
+		log.Warn("login failed", "username", input.Username, "ip", ip)
+		security.LogLoginAttempt(input.Username, ip, userAgent, false, "invalid_credentials")
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	accessToken, _ := utils.GenerateAccessToken(user.ID)
-	refreshToken, _ := utils.GenerateRefreshToken(user.ID)
+	// The attempt was counted as a failure up front; the password was right
+	if err := attempt.Release(); err != nil {
+		log.Error("failed to release login attempt", "error", err)
+	}
+
+	// Password is correct but a second factor is still needed
+	if security.TwoFactorRequired(&user) {
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+			return
+		}
+		security.LogLoginAttempt(user.Username, ip, userAgent, false, "mfa_pending")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"mfa_required":        true,
+			"mfa_token":           mfaToken,
+			"enrollment_required": !user.TOTPEnabled,
+		})
+		return
+	}
+
+	completeLogin(w, r, &user, nil)
+}
+
+// completeLogin resets throttling, records the successful login and writes
+// the token response. recoveryCodes is only set right after 2FA enrollment.
+func completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, recoveryCodes []string) {
+	ip := utils.ClientIP(r)
+	metrics.LoginAttemptsTotal.WithLabelValues("success").Inc()
+	if err := security.RecordLoginSuccess(user.Username); err != nil {
+		logger.FromContext(r.Context()).Error("failed to reset login throttle", "error", err)
+	}
+	security.LogLoginAttempt(user.Username, ip, r.UserAgent(), true, "")
+
+	session, err := security.CreateSession(user.ID, ip, r.UserAgent())
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, _ := utils.GenerateAccessToken(user.ID, user.RoleID, user.Role.PermissionVersion, session.ID)
+	refreshToken, _ := utils.GenerateRefreshToken(user.ID, session.ID)
 
 	response := map[string]interface{}{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
+		"session_id":    session.ID,
 		"user": map[string]interface{}{
 			"id":       user.ID,
 			"username": user.Username,
 			"role":     user.Role.Name,
 			"permissions": func() []string {
-				perms := []string{}
-				for _, p := range user.Role.Permissions {
-					perms = append(perms, p.Name)
+				grants, err := security.EffectivePermissions(user.RoleID)
+				if err != nil {
+					return []string{}
 				}
-				return perms
+				return security.PermissionNames(grants)
 			}(),
 		},
 	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+
+	// Keep the refresh token out of reach of scripts when cookie mode is on
+	if security.RefreshCookieEnabled() {
+		csrf, err := security.SetRefreshCookie(w, refreshToken)
+		if err != nil {
+			http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+			return
+		}
+		delete(response, "refresh_token")
+		response["csrf_token"] = csrf
+	}
 
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -66,6 +197,13 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 		RefreshToken string `json:"refresh_token"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&data)
+	if data.RefreshToken == "" {
+		// Cookie mode: the token arrives in the HttpOnly cookie (CSRF is
+		// checked by CSRFMiddleware)
+		if cookie, cerr := r.Cookie(security.RefreshCookieName); cerr == nil {
+			data.RefreshToken, err = cookie.Value, nil
+		}
+	}
 	if err != nil || data.RefreshToken == "" {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
@@ -77,8 +215,26 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A revoked session can no longer mint access tokens
 	userID := uint(claims["user_id"].(float64))
-	newAccessToken, _ := utils.GenerateAccessToken(userID)
+	session, err := security.ValidateSession(utils.SessionID(claims), userID, utils.ClientIP(r))
+	if err != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Reload the user so the new token reflects their current role
+	var user models.User
+	if err := requestDB(r).Preload("Role").First(&user, userID).Error; err != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	newAccessToken, err := utils.GenerateAccessToken(user.ID, user.RoleID, user.Role.PermissionVersion, session.ID)
+	if err != nil {
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
 
 	json.NewEncoder(w).Encode(map[string]string{
 		"access_token": newAccessToken,
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"wwb99/logger"
+	"wwb99/media"
+	"wwb99/models"
+	"wwb99/richtext"
+)
+
+// prepareContent runs the rich-text pipeline on a content field: render
+// Markdown, move embedded data: images into the media library, sanitize
+func prepareContent(r *http.Request, format, source string) (richtext.Document, error) {
+	rendered, err := richtext.Render(format, source)
+	if err != nil {
+		return richtext.Document{}, err
+	}
+	byID, by := actor(r)
+	if rendered, err = media.ExtractEmbedded(rendered, byID, by); err != nil {
+		return richtext.Document{}, err
+	}
+	return richtext.Prepare(rendered), nil
+}
+
+// contentError writes the response for a prepareContent failure
+func contentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, richtext.ErrUnknownFormat) || errors.Is(err, media.ErrTooLarge) ||
+		errors.Is(err, media.ErrNotAnImage) || errors.Is(err, media.ErrBadEncoding) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// prepareNews replaces the submitted content with sanitized HTML and fills
+// the derived fields
+func prepareNews(r *http.Request, news *models.News) (richtext.Document, error) {
+	doc, err := prepareContent(r, news.ContentFormat, news.Content)
+	if err != nil {
+		return doc, err
+	}
+	news.ContentFormat, news.ContentSource = contentSource(news.ContentFormat, news.Content)
+	news.Content = doc.HTML
+	news.ReadingTime = doc.ReadingTime
+	if strings.TrimSpace(news.Detail) == "" {
+		news.Detail = richtext.Excerpt(doc.Text, richtext.ExcerptLength())
+	} else {
+		news.Detail = richtext.Sanitize(news.Detail)
+	}
+	return doc, nil
+}
+
+func prepareHighlights(r *http.Request, h *models.Highlights) (richtext.Document, error) {
+	doc, err := prepareContent(r, h.ContentFormat, h.Content)
+	if err != nil {
+		return doc, err
+	}
+	h.ContentFormat, h.ContentSource = contentSource(h.ContentFormat, h.Content)
+	h.Content = doc.HTML
+	h.ReadingTime = doc.ReadingTime
+	return doc, nil
+}
+
+func contentSource(format, source string) (string, string) {
+	if format == richtext.FormatMarkdown {
+		return format, source
+	}
+	return richtext.FormatHTML, ""
+}
+
+// trackImages records the images an item's default-locale text uses. A
+// failure only affects the library, so it is logged rather than returned.
+func trackImages(r *http.Request, resourceType string, id uint, locale string, images []string) {
+	byID, by := actor(r)
+	if err := media.Track(resourceType, id, locale, images, byID, by); err != nil {
+		logger.FromContext(r.Context()).Error("failed to record media usage", "resource_type", resourceType, "resource_id", id, "error", err)
+	}
+}
@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"net/http"
+
+	"wwb99/config"
+
+	"gorm.io/gorm"
+)
+
+// requestDB returns the database bound to the request context, so queries
+// are cancelled with the request and the GORM logger tags its lines with
+// the request's logger (and request ID)
+func requestDB(r *http.Request) *gorm.DB {
+	return config.DB.WithContext(r.Context())
+}
@@ -4,18 +4,22 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"strings"
-	"wwb99/config"
+	"wwb99/audit"
+	"wwb99/i18n"
 	"wwb99/models"
+	"wwb99/webhooks"
 )
 
 func GetFootersHome(w http.ResponseWriter, r *http.Request) {
 	var footers []models.Footers
-	result := config.DB.Order("created_at DESC").Find(&footers)
+	// Manually ordered footers first; unordered (position 0) ones newest first
+	result := requestDB(r).Order("position = 0, position ASC, created_at DESC").Find(&footers)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
+	localize(w, r, footers)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Success",
@@ -25,28 +29,23 @@ func GetFootersHome(w http.ResponseWriter, r *http.Request) {
 
 // Get all footers with pagination, search, sorting
 func GetFooters(w http.ResponseWriter, r *http.Request) {
-	var footers []models.Footers
-
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	search := r.URL.Query().Get("search")
-	sortField := r.URL.Query().Get("sortBy")
-	order := r.URL.Query().Get("order")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		http.Error(w, "'page' query parameter is required and must be a positive integer", http.StatusBadRequest)
-		return
-	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		http.Error(w, "'limit' query parameter is required and must be a positive integer", http.StatusBadRequest)
+	list, err := parseListing(r, listOptions{
+		requirePage: true,
+		sorts: map[string]bool{
+			"id":         true,
+			"name":       true,
+			"created_at": true,
+			"position":   true,
+		},
+		defaultSort: "created_at",
+	})
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	offset := (page - 1) * limit
-	db := config.DB.Model(&models.Footers{})
+	search := r.URL.Query().Get("search")
+	db := requestDB(r).Model(&models.Footers{})
 
 	// Search by name or redirect
 	if search != "" {
@@ -57,41 +56,16 @@ func GetFooters(w http.ResponseWriter, r *http.Request) {
 	var total int64
 	db.Count(&total)
 
-	validSortFields := map[string]bool{
-		"id":         true,
-		"name":       true,
-		"created_at": true,
-	}
-
-	if !validSortFields[sortField] {
-		sortField = "created_at"
-	}
-
-	order = strings.ToLower(order)
-	if order != "asc" {
-		order = "desc"
-	}
-
-	result := db.Order(sortField + " " + order).
-		Limit(limit).
-		Offset(offset).
-		Find(&footers)
-
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	footers, info, err := findPage[models.Footers](list, db)
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	response := map[string]interface{}{
-		"data":       footers,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
-	}
+	localizeExplicit(w, r, footers)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(list.response(footers, total, info))
 }
 
 // Get footer by ID
@@ -109,12 +83,14 @@ func GetFooterByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var footer models.Footers
-	result := config.DB.First(&footer, id)
+	result := requestDB(r).First(&footer, id)
 	if result.Error != nil {
 		http.Error(w, "Footer not found", http.StatusNotFound)
 		return
 	}
 
+	localizeOneExplicit(w, r, &footer)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Success",
@@ -130,10 +106,12 @@ func CreateFooter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Create(&footer).Error; err != nil {
+	if err := requestDB(r).Create(&footer).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "create", "footers", footer.ID, nil, footer)
+	webhooks.Emit("footer.created", footer)
 
 	response := struct {
 		Message string         `json:"message"`
@@ -163,13 +141,14 @@ func UpdateFooter(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the Footers record exists
 	var existing models.Footers
-	if err := config.DB.First(&existing, Footers.ID).Error; err != nil {
+	if err := requestDB(r).First(&existing, Footers.ID).Error; err != nil {
 		http.Error(w, "Footers not found", http.StatusNotFound)
 		return
 	}
 
 	// Perform the update
-	err := config.DB.Model(&existing).Updates(models.Footers{
+	before := existing
+	err := requestDB(r).Model(&existing).Updates(models.Footers{
 		Name:     Footers.Name,
 		ImageURL: Footers.ImageURL,
 		Redirect: Footers.Redirect,
@@ -178,6 +157,8 @@ func UpdateFooter(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "update", "footers", existing.ID, before, existing)
+	webhooks.Emit("footer.updated", existing)
 
 	// Success response
 	w.Header().Set("Content-Type", "application/json")
@@ -192,7 +173,13 @@ func DeleteFooter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := config.DB.Delete(&models.Footers{}, id)
+	var existing models.Footers
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "Footer not found or already deleted", http.StatusNotFound)
+		return
+	}
+
+	result := requestDB(r).Delete(&models.Footers{}, existing.ID)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
@@ -202,7 +189,15 @@ func DeleteFooter(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Footer not found or already deleted", http.StatusNotFound)
 		return
 	}
+	audit.Record(r, "delete", "footers", existing.ID, existing, nil)
+	webhooks.Emit("footer.deleted", existing)
+	i18n.DeleteTranslations("footers", uint(existing.ID))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Footer deleted successfully"})
 }
+
+// ReorderFooters sets the manual display order of footers
+func ReorderFooters(w http.ResponseWriter, r *http.Request) {
+	reorder(w, r, &models.Footers{}, "footers", "footer.reordered")
+}
@@ -4,18 +4,27 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"wwb99/config"
+	"wwb99/audit"
+	"wwb99/i18n"
+	"wwb99/media"
 	"wwb99/models"
+	"wwb99/policy"
+	"wwb99/richtext"
+	"wwb99/search"
+	"wwb99/webhooks"
 )
 
 func GetHighlightsHome(w http.ResponseWriter, r *http.Request) {
 	var highlightsList []models.Highlights
-	result := config.DB.Order("created_at DESC").Limit(4).Find(&highlightsList)
+	// Manually ordered highlights first; unordered (position 0) ones newest first
+	result := requestDB(r).Order("position = 0, position ASC, created_at DESC").Limit(4).Find(&highlightsList)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	localize(w, r, highlightsList)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(highlightsList)
 }
@@ -33,12 +42,14 @@ func GetHighlightsByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var highlights models.Highlights
-	result := config.DB.First(&highlights, id)
+	result := requestDB(r).First(&highlights, id)
 	if result.Error != nil {
 		http.Error(w, "Highlights not found", http.StatusNotFound)
 		return
 	}
 
+	localizeOneExplicit(w, r, &highlights)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Success",
@@ -46,51 +57,37 @@ func GetHighlightsByID(w http.ResponseWriter, r *http.Request) {
 	})
 }
 func GetHighlights(w http.ResponseWriter, r *http.Request) {
-	var highlightsList []models.Highlights
-
-	// Parse pagination query params
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	page := 1
-	limit := 10
-
-	if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-		page = p
-	}
-	if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-		limit = l
+	// Newest first, or the manual home-page order with ?sortBy=position
+	list, err := parseListing(r, listOptions{
+		defaultLimit: 10,
+		sorts: map[string]bool{
+			"created_at": true,
+			"position":   true,
+		},
+		defaultSort: "created_at",
+		defaultAsc:  r.URL.Query().Get("sortBy") == "position",
+	})
+	if err != nil {
+		listError(w, err)
+		return
 	}
 
-	offset := (page - 1) * limit
+	db := requestDB(r).Model(&models.Highlights{})
 
 	// Get total record count
 	var total int64
-	config.DB.Model(&models.Highlights{}).Count(&total)
+	db.Count(&total)
 
-	// Fetch paginated results
-	result := config.DB.
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&highlightsList)
-
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	highlightsList, info, err := findPage[models.Highlights](list, db)
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	// Response JSON structure
-	response := map[string]interface{}{
-		"data":       highlightsList,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
-	}
+	localizeExplicit(w, r, highlightsList)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(list.response(highlightsList, total, info))
 }
 func CreateHighlights(w http.ResponseWriter, r *http.Request) {
 	var Highlights models.Highlights
@@ -101,14 +98,30 @@ func CreateHighlights(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set created_at (if not using GORM's auto time tracking)
-	// Highlights.CreatedAt = time.Now() // optional if your model uses `gorm:"autoCreateTime"`
+	if !allow(r, "create", policy.Resource{Type: "highlights"}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Authorship always comes from the authenticated caller
+	Highlights.ID = 0
+	Highlights.CreatedByID, Highlights.CreatedBy = actor(r)
+	Highlights.UpdatedByID, Highlights.UpdatedBy = Highlights.CreatedByID, Highlights.CreatedBy
+	doc, err := prepareHighlights(r, &Highlights)
+	if err != nil {
+		contentError(w, err)
+		return
+	}
 
 	// Save using GORM
-	if err := config.DB.Create(&Highlights).Error; err != nil {
+	if err := requestDB(r).Create(&Highlights).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "create", "highlights", Highlights.ID, nil, Highlights)
+	webhooks.Emit("highlight.created", Highlights)
+	search.Sync("highlights", uint(Highlights.ID))
+	trackImages(r, "highlights", uint(Highlights.ID), i18n.Default(), append(doc.Images, Highlights.Image))
 
 	// Return the created object as JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -131,22 +144,58 @@ func UpdateHighlights(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the Highlights record exists
 	var existing models.Highlights
-	if err := config.DB.First(&existing, Highlights.ID).Error; err != nil {
+	if err := requestDB(r).First(&existing, Highlights.ID).Error; err != nil {
 		http.Error(w, "Highlights not found", http.StatusNotFound)
 		return
 	}
 
-	// Perform the update
-	err := config.DB.Model(&existing).Updates(models.Highlights{
-		Title:     Highlights.Title,
-		Image:     Highlights.Image,
-		Content:   Highlights.Content,
-		CreatedBy: Highlights.CreatedBy,
-	}).Error
+	// Authors may only edit their own highlights, editors may edit all
+	if !allow(r, "update", policy.Resource{Type: "highlights", OwnerID: existing.CreatedByID}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	before := existing
+	updatedByID, updatedBy := actor(r)
+
+	if _, err := prepareHighlights(r, &Highlights); err != nil {
+		contentError(w, err)
+		return
+	}
+
+	// Perform the update. Omitted fields keep their values; when content is
+	// sent, its derived columns are written even if empty so that switching
+	// from Markdown back to HTML clears the stored source.
+	columns := []string{"updated_by", "updated_by_id"}
+	if Highlights.Title != "" {
+		columns = append(columns, "title")
+	}
+	if Highlights.Image != "" {
+		columns = append(columns, "image")
+	}
+	if Highlights.Content != "" {
+		columns = append(columns, "content", "content_format", "content_source", "reading_time")
+	}
+	err := requestDB(r).Model(&existing).
+		Select(columns).
+		Updates(models.Highlights{
+			Title:         Highlights.Title,
+			Image:         Highlights.Image,
+			Content:       Highlights.Content,
+			ContentFormat: Highlights.ContentFormat,
+			ContentSource: Highlights.ContentSource,
+			ReadingTime:   Highlights.ReadingTime,
+			UpdatedBy:     updatedBy,
+			UpdatedByID:   updatedByID,
+		}).Error
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "update", "highlights", existing.ID, before, existing)
+	webhooks.Emit("highlight.updated", existing)
+	search.Sync("highlights", uint(existing.ID))
+	trackImages(r, "highlights", uint(existing.ID), i18n.Default(), append(richtext.Images(existing.Content), existing.Image))
 
 	// Success response
 	w.Header().Set("Content-Type", "application/json")
@@ -160,8 +209,19 @@ func DeleteHighlights(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var existing models.Highlights
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "Highlights not found or already deleted", http.StatusNotFound)
+		return
+	}
+
+	if !allow(r, "delete", policy.Resource{Type: "highlights", OwnerID: existing.CreatedByID}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// Attempt to delete the Highlights with the given ID
-	result := config.DB.Delete(&models.Highlights{}, id)
+	result := requestDB(r).Delete(&models.Highlights{}, existing.ID)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
@@ -171,8 +231,18 @@ func DeleteHighlights(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Highlights not found or already deleted", http.StatusNotFound)
 		return
 	}
+	audit.Record(r, "delete", "highlights", existing.ID, existing, nil)
+	webhooks.Emit("highlight.deleted", existing)
+	i18n.DeleteTranslations("highlights", uint(existing.ID))
+	media.Release("highlights", uint(existing.ID))
+	search.Sync("highlights", uint(existing.ID))
 
 	// Respond with success message
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Highlights deleted successfully"})
 }
+
+// ReorderHighlights sets the manual home-page order of highlights
+func ReorderHighlights(w http.ResponseWriter, r *http.Request) {
+	reorder(w, r, &models.Highlights{}, "highlights", "highlight.reordered")
+}
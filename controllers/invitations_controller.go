@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/mail"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/audit"
+	"wwb99/logger"
+	"wwb99/mailer"
+	"wwb99/models"
+	"wwb99/security"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func invitationTTL() time.Duration {
+	if h, err := strconv.Atoi(os.Getenv("INVITATION_TTL_HOURS")); err == nil && h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return 72 * time.Hour
+}
+
+// CreateInvitation handles POST /api/invitations
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email          string `json:"email"`
+		RoleID         uint   `json:"role_id"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if req.RoleID == 0 {
+		http.Error(w, "Missing role_id", http.StatusBadRequest)
+		return
+	}
+
+	var role models.Role
+	if err := requestDB(r).First(&role, req.RoleID).Error; err != nil {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	}
+
+	// An inviter can't hand out permissions they don't hold themselves
+	inviterRole, _ := r.Context().Value("role_id").(uint)
+	granted, _, err := security.RolePermissions(role.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(granted)) {
+		if !security.RoleHasPermission(inviterRole, name) {
+			http.Error(w, "Role grants permissions you do not hold: "+name, http.StatusForbidden)
+			return
+		}
+	}
+
+	ttl := invitationTTL()
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	token, err := security.GenerateToken(32)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	invitedBy, _ := r.Context().Value("user_id").(uint)
+	invitation := models.Invitation{
+		Email:     req.Email,
+		RoleID:    role.ID,
+		TokenHash: security.HashToken(token),
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := requestDB(r).Create(&invitation).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invitation.Role = role
+	audit.Record(r, "create", "invitation", invitation.ID, nil, invitation)
+
+	link := appURL() + "/accept-invite?token=" + token
+	err = mailer.Send(r.Context(), mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited to WWB99",
+		Body: fmt.Sprintf("Hello,\n\nYou have been invited to join WWB99 as %s. Use the link below to choose your username and password. It expires on %s and can only be used once.\n\n%s\n",
+			role.Name, invitation.ExpiresAt.Format(time.RFC1123), link),
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to send invitation email", "invitation_id", invitation.ID, "error", err)
+	}
+
+	// The token is only returned here so the admin can share the link manually
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Invitation created successfully",
+		"data":    invitation,
+		"token":   token,
+		"link":    link,
+	})
+}
+
+// GetInvitations lists invitations, optionally filtered by ?status=pending|accepted|revoked|expired
+func GetInvitations(w http.ResponseWriter, r *http.Request) {
+	var invitations []models.Invitation
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset := (page - 1) * limit
+	db := requestDB(r).Model(&models.Invitation{})
+
+	now := time.Now()
+	switch r.URL.Query().Get("status") {
+	case "pending":
+		db = db.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case "accepted":
+		db = db.Where("accepted_at IS NOT NULL")
+	case "revoked":
+		db = db.Where("revoked_at IS NOT NULL")
+	case "expired":
+		db = db.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	}
+
+	if search := r.URL.Query().Get("search"); search != "" {
+		db = db.Where("email LIKE ?", "%"+search+"%")
+	}
+
+	var total int64
+	db.Count(&total)
+
+	result := db.Preload("Role").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&invitations)
+
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":       invitations,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeInvitation handles DELETE /api/invitations?id=
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	result := requestDB(r).Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		http.Error(w, "Invitation not found or no longer pending", http.StatusNotFound)
+		return
+	}
+	audit.Record(r, "revoke", "invitation", id, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invitation revoked successfully"})
+}
+
+func findPendingInvitation(r *http.Request, token string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := requestDB(r).Preload("Role").Where("token_hash = ?", security.HashToken(token)).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	if !invitation.Pending(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &invitation, nil
+}
+
+// GetInvitationByToken lets the invite page show who the invitation is for
+func GetInvitationByToken(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token parameter", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := findPendingInvitation(r, token)
+	if err != nil {
+		http.Error(w, "Invalid or expired invitation", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Success",
+		"data": map[string]interface{}{
+			"email":      invitation.Email,
+			"role":       invitation.Role.Name,
+			"expires_at": invitation.ExpiresAt,
+		},
+	})
+}
+
+// AcceptInvitation redeems an invitation, creating the user with the invited role
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		http.Error(w, "Missing username", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := findPendingInvitation(r, req.Token)
+	if err != nil {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+
+	if err := security.ValidatePassword(req.Password, req.Username); err != nil {
+		writePasswordPolicyError(w, err)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	user := models.User{
+		Username: req.Username,
+		Email:    invitation.Email,
+		Password: string(hashed),
+		RoleID:   invitation.RoleID,
+	}
+
+	errUsernameTaken := errors.New("username taken")
+	err = requestDB(r).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUsernameTaken
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		// Guard on accepted_at so the same invitation can't be redeemed twice
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{
+				"accepted_at":      time.Now(),
+				"accepted_user_id": user.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errUsernameTaken):
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Account created successfully",
+		"data": map[string]interface{}{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"role":     invitation.Role.Name,
+		},
+	})
+}
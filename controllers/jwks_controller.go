@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"wwb99/audit"
+	"wwb99/utils"
+)
+
+// GetJWKS publishes the public keys other services use to verify our tokens
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": utils.JWKS(),
+	})
+}
+
+// RotateSigningKey forces a new signing key; previous keys keep verifying
+// until their grace period ends
+func RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	if err := utils.RotateSigningKey(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "rotate", "signing_key", "", nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Signing key rotated successfully"})
+}
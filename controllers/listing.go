@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// maxPageLimit caps ?limit= so a single request can't pull the whole table
+const maxPageLimit = 100
+
+// List endpoints share these query parameters:
+//
+//	page, limit   offset pagination (limit is capped at maxPageLimit)
+//	cursor        keyset pagination; send an empty cursor for the first page,
+//	              then next_cursor/prev_cursor from the previous response
+//	sortBy, order sort column and asc/desc; ties are broken by id
+//	fields        comma separated JSON fields to return (id is always kept)
+//
+// Cursors are opaque to clients and only valid for the sort they were
+// issued with. Unlike offsets they don't skip or repeat rows when items are
+// inserted between page loads.
+type listing struct {
+	page       int
+	limit      int
+	sort       string
+	desc       bool
+	cursorMode bool
+	cursor     *cursor
+	fields     []string // JSON names; empty means all
+	columns    []string // extra columns a preload needs
+	includes   []string // associations kept in a fieldset
+}
+
+// listOptions describes what a list endpoint accepts
+type listOptions struct {
+	defaultLimit int             // 10 when zero
+	requirePage  bool            // reject a missing page in offset mode
+	sorts        map[string]bool // allowed sortBy columns
+	defaultSort  string
+	defaultAsc   bool // order when ?order= is absent
+}
+
+// cursor is the decoded ?cursor= token: the sort it belongs to and the sort
+// value and ID of the row to continue after (or before, for Prev)
+type cursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d,omitempty"`
+	Value json.RawMessage `json:"v"`
+	Time  bool            `json:"t,omitempty"` // Value is an RFC 3339 timestamp
+	ID    uint            `json:"i"`
+	Prev  bool            `json:"p,omitempty"`
+}
+
+// paramError is a list request the client got wrong
+type paramError string
+
+func (e paramError) Error() string { return string(e) }
+
+const errBadCursor = paramError("invalid cursor")
+
+func (c *cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || len(c.Value) == 0 {
+		return nil, errBadCursor
+	}
+	return &c, nil
+}
+
+// value returns the sort value as a query argument
+func (c *cursor) value() (interface{}, error) {
+	if c.Time {
+		var s string
+		if err := json.Unmarshal(c.Value, &s); err != nil {
+			return nil, errBadCursor
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, errBadCursor
+		}
+		return t, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(c.Value)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, errBadCursor
+	}
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, errBadCursor
+		}
+		return f, nil
+	case string, bool:
+		return v, nil
+	}
+	return nil, errBadCursor
+}
+
+// parseListing reads the pagination, sort and fieldset parameters
+func parseListing(r *http.Request, opts listOptions) (*listing, error) {
+	q := r.URL.Query()
+	l := &listing{page: 1, limit: opts.defaultLimit, sort: q.Get("sortBy")}
+	if l.limit < 1 {
+		l.limit = 10
+	}
+
+	if !opts.sorts[l.sort] {
+		l.sort = opts.defaultSort
+	}
+	if order := strings.ToLower(q.Get("order")); order == "" {
+		l.desc = !opts.defaultAsc
+	} else {
+		l.desc = order != "asc"
+	}
+
+	_, l.cursorMode = q["cursor"]
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != l.sort || c.Desc != l.desc {
+			return nil, paramError("cursor was issued for a different sortBy/order")
+		}
+		l.cursor = c
+	}
+
+	if !l.cursorMode {
+		page, err := strconv.Atoi(q.Get("page"))
+		switch {
+		case err == nil && page >= 1:
+			l.page = page
+		case opts.requirePage:
+			return nil, paramError("'page' query parameter is required and must be a positive integer")
+		}
+	}
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	switch {
+	case err == nil && limit >= 1:
+		l.limit = limit
+	case opts.requirePage && !l.cursorMode:
+		return nil, paramError("'limit' query parameter is required and must be a positive integer")
+	}
+	l.limit = min(l.limit, maxPageLimit)
+
+	for _, f := range strings.Split(q.Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" && !slices.Contains(l.fields, f) {
+			l.fields = append(l.fields, f)
+		}
+	}
+	return l, nil
+}
+
+// parseIncludes reads ?include= and returns the association names to
+// preload. allowed maps include names to associations.
+func parseIncludes(r *http.Request, allowed map[string]string) ([]string, error) {
+	var assocs []string
+	for _, name := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		assoc, ok := allowed[name]
+		if !ok {
+			names := make([]string, 0, len(allowed))
+			for n := range allowed {
+				names = append(names, n)
+			}
+			slices.Sort(names)
+			return nil, paramError(fmt.Sprintf("unknown include %q, use one of: %s", name, strings.Join(names, ", ")))
+		}
+		assocs = append(assocs, assoc)
+	}
+	return assocs, nil
+}
+
+// preload loads associations requested with ?include=. columns are the
+// foreign keys those associations need when a fieldset is requested.
+func (l *listing) preload(db *gorm.DB, assocs []string, columns ...string) *gorm.DB {
+	for _, assoc := range assocs {
+		db = db.Preload(assoc)
+		l.includes = append(l.includes, assoc)
+	}
+	if len(assocs) > 0 {
+		l.columns = append(l.columns, columns...)
+	}
+	return db
+}
+
+var schemaCache sync.Map
+
+// jsonName is the key a field is encoded under
+func jsonName(f *schema.Field) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// selectColumns maps the requested fieldset to columns, always including the
+// primary key and sort column
+func (l *listing) selectColumns(s *schema.Schema) ([]string, error) {
+	if len(l.fields) == 0 {
+		return nil, nil
+	}
+	byJSON := make(map[string]*schema.Field)
+	for _, f := range s.Fields {
+		if f.DBName != "" && f.Readable {
+			byJSON[jsonName(f)] = f
+		}
+	}
+
+	columns := []string{s.PrioritizedPrimaryField.DBName, l.sort}
+	for _, name := range l.fields {
+		if f, ok := byJSON[name]; ok {
+			columns = append(columns, f.DBName)
+			continue
+		}
+		if slices.ContainsFunc(l.includes, func(assoc string) bool { return strings.EqualFold(assoc, name) }) {
+			continue
+		}
+		return nil, paramError(fmt.Sprintf("unknown field %q", name))
+	}
+	columns = append(columns, l.columns...)
+	slices.Sort(columns)
+	return slices.Compact(columns), nil
+}
+
+// pageInfo holds the cursors of a fetched page
+type pageInfo struct {
+	next, prev string
+}
+
+// findPage fetches one page of T using the listing's sort, pagination and
+// fieldset. db carries the endpoint's filters.
+func findPage[T any](l *listing, db *gorm.DB) ([]T, pageInfo, error) {
+	var items []T
+	var info pageInfo
+
+	s, err := schema.Parse(new(T), &schemaCache, db.NamingStrategy)
+	if err != nil {
+		return nil, info, err
+	}
+	sortField := s.LookUpField(l.sort)
+	pk := s.PrioritizedPrimaryField
+	if sortField == nil || pk == nil {
+		return nil, info, paramError(fmt.Sprintf("cannot sort by %q", l.sort))
+	}
+
+	columns, err := l.selectColumns(s)
+	if err != nil {
+		return nil, info, err
+	}
+	if columns != nil {
+		db = db.Select(columns)
+	}
+
+	desc := l.desc
+	if !l.cursorMode {
+		err := db.Order(orderBy(sortField.DBName, pk.DBName, desc)).
+			Limit(l.limit).
+			Offset((l.page - 1) * l.limit).
+			Find(&items).Error
+		return items, info, err
+	}
+
+	if sortField.FieldType.Kind() == reflect.Ptr {
+		return nil, info, paramError(fmt.Sprintf("sortBy %q does not support cursor pagination", l.sort))
+	}
+
+	// Walking backwards reads the preceding rows in reverse order
+	back := l.cursor != nil && l.cursor.Prev
+	if back {
+		desc = !desc
+	}
+	if l.cursor != nil {
+		v, err := l.cursor.value()
+		if err != nil {
+			return nil, info, err
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		db = db.Where(fmt.Sprintf("((%[1]s %[2]s ?) OR (%[1]s = ? AND %[3]s %[2]s ?))", sortField.DBName, op, pk.DBName),
+			v, v, l.cursor.ID)
+	}
+
+	if err := db.Order(orderBy(sortField.DBName, pk.DBName, desc)).Limit(l.limit + 1).Find(&items).Error; err != nil {
+		return nil, info, err
+	}
+
+	more := len(items) > l.limit
+	if more {
+		items = items[:l.limit]
+	}
+	if back {
+		slices.Reverse(items)
+	}
+
+	hasNext, hasPrev := more, l.cursor != nil
+	if back {
+		hasNext, hasPrev = true, more
+	}
+	if len(items) > 0 {
+		if hasNext {
+			info.next = l.cursorAt(sortField, pk, &items[len(items)-1], false)
+		}
+		if hasPrev {
+			info.prev = l.cursorAt(sortField, pk, &items[0], true)
+		}
+	}
+	return items, info, nil
+}
+
+func orderBy(column, pk string, desc bool) string {
+	if desc {
+		return column + " DESC, " + pk + " DESC"
+	}
+	return column + " ASC, " + pk + " ASC"
+}
+
+// cursorAt builds the cursor continuing after (or before) item
+func (l *listing) cursorAt(sortField, pk *schema.Field, item interface{}, prev bool) string {
+	ctx := context.Background()
+	rv := reflect.ValueOf(item).Elem()
+	v, _ := sortField.ValueOf(ctx, rv)
+	id, _ := pk.ValueOf(ctx, rv)
+
+	c := cursor{Sort: l.sort, Desc: l.desc, Prev: prev}
+	if t, ok := v.(time.Time); ok {
+		c.Time = true
+		v = t.Format(time.RFC3339Nano)
+	}
+	c.Value, _ = json.Marshal(v)
+	switch id := id.(type) {
+	case uint:
+		c.ID = id
+	case int:
+		c.ID = uint(id)
+	}
+	return c.encode()
+}
+
+// response builds the list envelope. Offset pages report page/totalPages,
+// cursor pages report next_cursor/prev_cursor (null at either end).
+func (l *listing) response(items interface{}, total int64, info pageInfo) map[string]interface{} {
+	response := map[string]interface{}{
+		"data":  l.project(items),
+		"total": total,
+		"limit": l.limit,
+	}
+	if l.cursorMode {
+		response["next_cursor"] = nullable(info.next)
+		response["prev_cursor"] = nullable(info.prev)
+		return response
+	}
+	response["page"] = l.page
+	response["totalPages"] = int((total + int64(l.limit) - 1) / int64(l.limit))
+	return response
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// project keeps only the requested fields of each item (plus id and any
+// association brought in by ?include=)
+func (l *listing) project(items interface{}) interface{} {
+	if len(l.fields) == 0 {
+		return items
+	}
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return items
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return items
+	}
+	keep := func(key string) bool {
+		return strings.EqualFold(key, "id") || slices.Contains(l.fields, key) ||
+			slices.ContainsFunc(l.includes, func(assoc string) bool { return strings.EqualFold(assoc, key) })
+	}
+	for _, row := range rows {
+		for key := range row {
+			if !keep(key) {
+				delete(row, key)
+			}
+		}
+	}
+	return rows
+}
+
+// listError writes a parseListing/findPage failure
+func listError(w http.ResponseWriter, err error) {
+	var bad paramError
+	if errors.As(err, &bad) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
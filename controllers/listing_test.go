@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type listItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var listSorts = map[string]bool{"id": true, "score": true, "created_at": true}
+
+// memoryDB opens an empty in-memory database with the given models migrated
+func memoryDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // every connection would get its own memory database
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// listDB returns an in-memory database of ten items with tied scores and
+// timestamps
+func listDB(t *testing.T) (*gorm.DB, []listItem) {
+	t.Helper()
+	db := memoryDB(t, &listItem{})
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := make([]listItem, 10)
+	for i := range items {
+		items[i] = listItem{
+			ID:        uint(i + 1),
+			Score:     []int{3, 1, 2, 3, 1, 2, 3, 1, 2, 3}[i],
+			CreatedAt: base.Add(time.Duration(i/2) * time.Minute),
+		}
+	}
+	if err := db.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, items
+}
+
+// expectedOrder sorts ids by key, then id, like findPage does
+func expectedOrder(items []listItem, key func(listItem) int64, desc bool) []uint {
+	sorted := slices.Clone(items)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if ka, kb := key(a), key(b); ka != kb {
+			return (ka < kb) != desc
+		}
+		return (a.ID < b.ID) != desc
+	})
+	ids := make([]uint, len(sorted))
+	for i, item := range sorted {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+// fetch runs one cursor-mode list request
+func fetch(t *testing.T, db *gorm.DB, q url.Values) ([]uint, pageInfo) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/?"+q.Encode(), nil)
+	l, err := parseListing(r, listOptions{sorts: listSorts, defaultSort: "id"})
+	if err != nil {
+		t.Fatalf("parseListing(%s): %v", q.Encode(), err)
+	}
+	items, info, err := findPage[listItem](l, db.Model(&listItem{}))
+	if err != nil {
+		t.Fatalf("findPage(%s): %v", q.Encode(), err)
+	}
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids, info
+}
+
+func TestFindPageCursor(t *testing.T) {
+	db, items := listDB(t)
+
+	tests := []struct {
+		name  string
+		sort  string
+		order string
+		limit string
+		key   func(listItem) int64
+		desc  bool
+	}{
+		{"id asc", "id", "asc", "3", func(i listItem) int64 { return int64(i.ID) }, false},
+		{"id desc, exact pages", "id", "desc", "5", func(i listItem) int64 { return int64(i.ID) }, true},
+		{"tied score asc", "score", "asc", "3", func(i listItem) int64 { return int64(i.Score) }, false},
+		{"tied score desc", "score", "desc", "4", func(i listItem) int64 { return int64(i.Score) }, true},
+		{"tied time desc", "created_at", "desc", "3", func(i listItem) int64 { return i.CreatedAt.Unix() }, true},
+		{"tied time asc", "created_at", "asc", "2", func(i listItem) int64 { return i.CreatedAt.Unix() }, false},
+		{"single page", "id", "asc", "20", func(i listItem) int64 { return int64(i.ID) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := expectedOrder(items, tt.key, tt.desc)
+			q := url.Values{"sortBy": {tt.sort}, "order": {tt.order}, "limit": {tt.limit}, "cursor": {""}}
+
+			// Forward: next_cursor until it runs out
+			var pages [][]uint
+			var infos []pageInfo
+			for {
+				ids, info := fetch(t, db, q)
+				pages = append(pages, ids)
+				infos = append(infos, info)
+				if info.next == "" {
+					break
+				}
+				if len(pages) > len(items) {
+					t.Fatal("next_cursor never ends")
+				}
+				q.Set("cursor", info.next)
+			}
+			if got := slices.Concat(pages...); !slices.Equal(got, want) {
+				t.Fatalf("forward order = %v, want %v", got, want)
+			}
+			for i, info := range infos {
+				if (info.prev != "") != (i > 0) {
+					t.Errorf("page %d: prev_cursor = %q, want one only after the first page", i, info.prev)
+				}
+				if (info.next != "") != (i < len(infos)-1) {
+					t.Errorf("page %d: next_cursor = %q, want one only before the last page", i, info.next)
+				}
+			}
+
+			// Backward: prev_cursor from the last page returns the same pages
+			for i := len(pages) - 1; i > 0; i-- {
+				q.Set("cursor", infos[i].prev)
+				ids, info := fetch(t, db, q)
+				if !slices.Equal(ids, pages[i-1]) {
+					t.Fatalf("page %d backwards = %v, want %v", i-1, ids, pages[i-1])
+				}
+				if info.next == "" {
+					t.Errorf("page %d backwards: missing next_cursor", i-1)
+				}
+				if (info.prev != "") != (i-1 > 0) {
+					t.Errorf("page %d backwards: prev_cursor = %q, want one only after the first page", i-1, info.prev)
+				}
+			}
+		})
+	}
+}
+
+func TestParseListingCursorMismatch(t *testing.T) {
+	db, _ := listDB(t)
+	_, info := fetch(t, db, url.Values{"sortBy": {"score"}, "order": {"asc"}, "limit": {"3"}, "cursor": {""}})
+	if info.next == "" {
+		t.Fatal("expected a next cursor")
+	}
+
+	tests := []struct {
+		name string
+		q    url.Values
+	}{
+		{"other sort", url.Values{"sortBy": {"created_at"}, "order": {"asc"}, "cursor": {info.next}}},
+		{"other order", url.Values{"sortBy": {"score"}, "order": {"desc"}, "cursor": {info.next}}},
+		{"garbage", url.Values{"sortBy": {"score"}, "order": {"asc"}, "cursor": {"not-a-cursor"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.q.Encode(), nil)
+			_, err := parseListing(r, listOptions{sorts: listSorts, defaultSort: "id"})
+			var bad paramError
+			if !errors.As(err, &bad) {
+				t.Fatalf("err = %v, want a paramError", err)
+			}
+		})
+	}
+}
+
+func TestCursorValueRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 5, 10, 30, 15, 123456789, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"int", 42, int64(42)},
+		{"float", 1.5, 1.5},
+		{"string", "a,b", "a,b"},
+		{"bool", true, true},
+		{"time", at, at},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cursor{Sort: "x", ID: 7}
+			if ts, ok := tt.value.(time.Time); ok {
+				c.Time = true
+				c.Value, _ = json.Marshal(ts.Format(time.RFC3339Nano))
+			} else {
+				c.Value, _ = json.Marshal(tt.value)
+			}
+			decoded, err := decodeCursor(c.encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decoded.value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, ok := tt.want.(time.Time); ok {
+				// Bound as a time, not a string, so MySQL compares DATETIMEs
+				gt, ok := got.(time.Time)
+				if !ok || !gt.Equal(want) {
+					t.Fatalf("value = %#v, want %v", got, want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindPageCursorPredicate(t *testing.T) {
+	db, _ := listDB(t)
+	at := time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		order string
+		prev  bool
+		want  string
+	}{
+		{"desc next", "desc", false, "((created_at < ?) OR (created_at = ? AND id < ?))"},
+		{"desc prev", "desc", true, "((created_at > ?) OR (created_at = ? AND id > ?))"},
+		{"asc next", "asc", false, "((created_at > ?) OR (created_at = ? AND id > ?))"},
+		{"asc prev", "asc", true, "((created_at < ?) OR (created_at = ? AND id < ?))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cursor{Sort: "created_at", Desc: tt.order == "desc", Time: true, ID: 5, Prev: tt.prev}
+			c.Value, _ = json.Marshal(at.Format(time.RFC3339Nano))
+			q := url.Values{"sortBy": {"created_at"}, "order": {tt.order}, "limit": {"3"}, "cursor": {c.encode()}}
+			l, err := parseListing(httptest.NewRequest("GET", "/?"+q.Encode(), nil), listOptions{sorts: listSorts, defaultSort: "id"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dry := db.Session(&gorm.Session{DryRun: true}).Model(&listItem{})
+			var stmt *gorm.Statement
+			dry.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) { stmt = tx.Statement })
+			defer dry.Callback().Query().Remove("test:capture")
+			if _, _, err := findPage[listItem](l, dry); err != nil {
+				t.Fatal(err)
+			}
+
+			sql := stmt.SQL.String()
+			if !strings.Contains(strings.ReplaceAll(sql, "`", ""), tt.want) {
+				t.Fatalf("sql = %s, want predicate %s", sql, tt.want)
+			}
+			if len(stmt.Vars) < 3 {
+				t.Fatalf("vars = %v", stmt.Vars)
+			}
+			for _, v := range stmt.Vars[:2] {
+				if got, ok := v.(time.Time); !ok || !got.Equal(at) {
+					t.Fatalf("sort value bound as %#v, want time %v", v, at)
+				}
+			}
+			if stmt.Vars[2] != uint(5) {
+				t.Fatalf("id bound as %#v, want 5", stmt.Vars[2])
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/audit"
+	"wwb99/models"
+	"wwb99/security"
+)
+
+// GetLockouts lists keys (ip:... / user:...) with recorded failures; pass
+// ?locked=true to only show keys that are currently locked
+func GetLockouts(w http.ResponseWriter, r *http.Request) {
+	var throttles []models.LoginThrottle
+
+	db := requestDB(r).Model(&models.LoginThrottle{})
+	if r.URL.Query().Get("locked") == "true" {
+		db = db.Where("locked_until > ?", time.Now())
+	}
+
+	if err := db.Order("last_failure_at DESC").Find(&throttles).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Success",
+		"data":    throttles,
+	})
+}
+
+// ClearLockout removes throttle state by ?username=, ?ip= or a raw ?key=
+func ClearLockout(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var keys []string
+	if username := strings.TrimSpace(q.Get("username")); username != "" {
+		keys = append(keys, security.UserKey(username))
+	}
+	if ip := strings.TrimSpace(q.Get("ip")); ip != "" {
+		keys = append(keys, security.IPKey(ip))
+	}
+	if key := strings.TrimSpace(q.Get("key")); key != "" {
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		http.Error(w, "Missing username, ip or key parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := security.ClearLockout(keys...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "clear", "lockout", strings.Join(keys, ","), nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Lockout cleared successfully"})
+}
+
+// GetLoginAttempts returns the paginated login audit trail
+func GetLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	var attempts []models.LoginAttempt
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset := (page - 1) * limit
+	db := requestDB(r).Model(&models.LoginAttempt{})
+
+	if username := r.URL.Query().Get("username"); username != "" {
+		db = db.Where("username = ?", username)
+	}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		db = db.Where("ip = ?", ip)
+	}
+	switch r.URL.Query().Get("success") {
+	case "true":
+		db = db.Where("success = ?", true)
+	case "false":
+		db = db.Where("success = ?", false)
+	}
+
+	var total int64
+	db.Count(&total)
+
+	result := db.Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&attempts)
+
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":       attempts,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"wwb99/audit"
+	"wwb99/media"
+	"wwb99/models"
+)
+
+// GetMedia lists the media library, newest first. Filters: source
+// (embedded, external), resource_type and resource_id (items used by that
+// content), unused=true.
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	var list []models.Media
+	q := r.URL.Query()
+
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	offset := (page - 1) * limit
+
+	db := requestDB(r).Model(&models.Media{})
+	if v := q.Get("source"); v != "" {
+		db = db.Where("source = ?", v)
+	}
+	if v := q.Get("resource_type"); v != "" {
+		usages := requestDB(r).Model(&models.MediaUsage{}).Select("media_id").Where("resource_type = ?", v)
+		if id := q.Get("resource_id"); id != "" {
+			usages = usages.Where("resource_id = ?", id)
+		}
+		db = db.Where("id IN (?)", usages)
+	}
+	if q.Get("unused") == "true" {
+		db = db.Where("id NOT IN (?)", requestDB(r).Model(&models.MediaUsage{}).Select("media_id"))
+	}
+
+	var total int64
+	db.Count(&total)
+
+	if err := db.Order("id DESC").Limit(limit).Offset(offset).Find(&list).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Attach usage counts
+	if len(list) > 0 {
+		ids := make([]uint, len(list))
+		for i, m := range list {
+			ids[i] = m.ID
+		}
+		var counts []struct {
+			MediaID uint
+			N       int64
+		}
+		requestDB(r).Model(&models.MediaUsage{}).Select("media_id, COUNT(*) AS n").
+			Where("media_id IN ?", ids).Group("media_id").Scan(&counts)
+		byID := make(map[uint]int64, len(counts))
+		for _, c := range counts {
+			byID[c.MediaID] = c.N
+		}
+		for i := range list {
+			list[i].Usages = byID[list[i].ID]
+		}
+	}
+
+	response := map[string]interface{}{
+		"data":       list,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteMedia removes an unused media item (DELETE /api/media?id=)
+func DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryID(r)
+	if !ok {
+		http.Error(w, "Missing or invalid media ID", http.StatusBadRequest)
+		return
+	}
+
+	var existing models.Media
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+
+	if err := media.Delete(&existing); err != nil {
+		if errors.Is(err, media.ErrInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "delete", "media", existing.ID, existing, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Media deleted successfully"})
+}
+
+// ServeMedia serves stored files under /media/. Directory listings are
+// refused.
+func ServeMedia() http.Handler {
+	files := http.StripPrefix("/media/", http.FileServer(http.Dir(media.Dir())))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -4,19 +4,25 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"strings"
-	"wwb99/config"
+	"wwb99/audit"
+	"wwb99/i18n"
+	"wwb99/media"
 	"wwb99/models"
+	"wwb99/policy"
+	"wwb99/search"
+	"wwb99/webhooks"
 )
 
 func GetNewsHome(w http.ResponseWriter, r *http.Request) {
 	var newsList []models.News
-	result := config.DB.Order("created_at DESC").Limit(4).Find(&newsList)
+	result := requestDB(r).Order("created_at DESC").Limit(4).Find(&newsList)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	localize(w, r, newsList)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(newsList)
 }
@@ -35,12 +41,14 @@ func GetNewsByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var news models.News
-	result := config.DB.First(&news, id)
+	result := requestDB(r).First(&news, id)
 	if result.Error != nil {
 		http.Error(w, "News not found", http.StatusNotFound)
 		return
 	}
 
+	localizeOneExplicit(w, r, &news)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Success",
@@ -49,82 +57,50 @@ func GetNewsByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetNews(w http.ResponseWriter, r *http.Request) {
-	var newsList []models.News
-
-	// Parse query params
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	search := r.URL.Query().Get("search")
-	sortField := r.URL.Query().Get("sortBy")
-	order := r.URL.Query().Get("order")
-
-	// Parse page and limit, error if invalid or missing
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		http.Error(w, "'page' query parameter is required and must be a positive integer", http.StatusBadRequest)
-		return
-	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		http.Error(w, "'limit' query parameter is required and must be a positive integer", http.StatusBadRequest)
+	// Parse pagination, sort (id, title, created_at, created_by) and fieldset
+	list, err := parseListing(r, listOptions{
+		requirePage: true,
+		sorts: map[string]bool{
+			"id":         true,
+			"title":      true,
+			"created_at": true,
+			"created_by": true,
+		},
+		defaultSort: "created_at",
+	})
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	offset := (page - 1) * limit
+	search := r.URL.Query().Get("search")
+	category := r.URL.Query().Get("category")
 
-	db := config.DB.Model(&models.News{})
+	db := requestDB(r).Model(&models.News{})
 
 	// Apply search filter if present
 	if search != "" {
 		likeQuery := "%" + search + "%"
 		db = db.Where("title LIKE ? OR detail LIKE ?", likeQuery, likeQuery)
 	}
+	if category != "" {
+		db = db.Where("category = ?", category)
+	}
 
 	// Count total records after search filter
 	var total int64
 	db.Count(&total)
 
-	// Validate sortField, allow new fields: id, title, created_at, created_by
-	validSortFields := map[string]bool{
-		"id":         true,
-		"title":      true,
-		"created_at": true,
-		"created_by": true,
-	}
-
-	if !validSortFields[sortField] {
-		sortField = "created_at" // default sort field
-	}
-
-	// Validate order param
-	order = strings.ToLower(order)
-	if order != "asc" {
-		order = "desc" // default order
-	}
-
-	// Apply sorting, limit and offset
-	result := db.Order(sortField + " " + order).
-		Limit(limit).
-		Offset(offset).
-		Find(&newsList)
-
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	newsList, info, err := findPage[models.News](list, db)
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	// Build and send response
-	response := map[string]interface{}{
-		"data":       newsList,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
-	}
+	localizeExplicit(w, r, newsList)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(list.response(newsList, total, info))
 }
 
 func CreateNews(w http.ResponseWriter, r *http.Request) {
@@ -134,11 +110,28 @@ func CreateNews(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !allow(r, "create", policy.Resource{Type: "news"}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// Authorship always comes from the authenticated caller
+	news.ID = 0
+	news.CreatedByID, news.CreatedBy = actor(r)
+	news.UpdatedByID, news.UpdatedBy = news.CreatedByID, news.CreatedBy
+	doc, err := prepareNews(r, &news)
+	if err != nil {
+		contentError(w, err)
+		return
+	}
 	// Save using GORM
-	if err := config.DB.Create(&news).Error; err != nil {
+	if err := requestDB(r).Create(&news).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "create", "news", news.ID, nil, news)
+	webhooks.Emit("news.created", news)
+	search.Sync("news", uint(news.ID))
+	trackImages(r, "news", uint(news.ID), i18n.Default(), append(doc.Images, news.Image))
 	// Prepare response
 	response := struct {
 		Message string      `json:"message"`
@@ -177,23 +170,42 @@ func UpdateNews(w http.ResponseWriter, r *http.Request) {
 
 	// ✅ Check if the record exists
 	var existing models.News
-	if err := config.DB.First(&existing, id).Error; err != nil {
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
 		http.Error(w, `{"message":"News not found"}`, http.StatusNotFound)
 		return
 	}
 
+	// ✅ Authors may only edit their own news, editors may edit all
+	if !allow(r, "update", policy.Resource{Type: "news", OwnerID: existing.CreatedByID}) {
+		http.Error(w, `{"message":"Forbidden"}`, http.StatusForbidden)
+		return
+	}
+
+	before := existing
+
 	// ✅ Update fields
 	existing.Title = updatedData.Title
 	existing.Image = updatedData.Image
 	existing.Detail = updatedData.Detail
 	existing.Content = updatedData.Content
-	existing.CreatedBy = updatedData.CreatedBy
+	existing.ContentFormat = updatedData.ContentFormat
+	existing.Category = updatedData.Category
+	existing.UpdatedByID, existing.UpdatedBy = actor(r)
+	doc, err := prepareNews(r, &existing)
+	if err != nil {
+		contentError(w, err)
+		return
+	}
 
 	// ✅ Save to DB
-	if err := config.DB.Save(&existing).Error; err != nil {
+	if err := requestDB(r).Save(&existing).Error; err != nil {
 		http.Error(w, `{"message":"Failed to update news"}`, http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "update", "news", existing.ID, before, existing)
+	webhooks.Emit("news.updated", existing)
+	search.Sync("news", uint(existing.ID))
+	trackImages(r, "news", uint(existing.ID), i18n.Default(), append(doc.Images, existing.Image))
 
 	// ✅ JSON Response
 	response := struct {
@@ -215,8 +227,19 @@ func DeleteNews(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var existing models.News
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "News not found or already deleted", http.StatusNotFound)
+		return
+	}
+
+	if !allow(r, "delete", policy.Resource{Type: "news", OwnerID: existing.CreatedByID}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// Attempt to delete the news with the given ID
-	result := config.DB.Delete(&models.News{}, id)
+	result := requestDB(r).Delete(&models.News{}, existing.ID)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
@@ -226,6 +249,11 @@ func DeleteNews(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "News not found or already deleted", http.StatusNotFound)
 		return
 	}
+	audit.Record(r, "delete", "news", existing.ID, existing, nil)
+	webhooks.Emit("news.deleted", existing)
+	i18n.DeleteTranslations("news", uint(existing.ID))
+	media.Release("news", uint(existing.ID))
+	search.Sync("news", uint(existing.ID))
 
 	// Respond with success message
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/audit"
+	"wwb99/config"
+	"wwb99/logger"
+	"wwb99/mailer"
+	"wwb99/models"
+	"wwb99/security"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// writePasswordPolicyError reports policy violations as a 400 with details
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+	var policyErr *security.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Password does not meet the password policy",
+		"errors":  policyErr.Violations,
+	})
+	return true
+}
+
+// appURL is the public frontend base URL used in emailed links
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "http://localhost:5173"
+}
+
+func passwordResetTTL() time.Duration {
+	if m, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_TTL_MINUTES")); err == nil && m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return time.Hour
+}
+
+// ChangePassword handles PUT /api/profile/password for the logged-in user
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)) != nil {
+		http.Error(w, "Old password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	if err := security.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		writePasswordPolicyError(w, err)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := requestDB(r).Model(user).Update("password", string(hashed)).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "change_password", "user", user.ID, nil, nil)
+
+	// Sign out every other device; the current session stays valid
+	sessionID, _ := r.Context().Value("session_id").(uint)
+	security.RevokeUserSessions(user.ID, sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"})
+}
+
+// ForgotPassword handles POST /api/password/forgot. It always answers the same
+// way so it can't be used to discover which accounts exist.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Email == "" && req.Username == "" {
+		http.Error(w, "Missing email or username", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	db := requestDB(r)
+	if req.Email != "" {
+		db = db.Where("email = ?", req.Email)
+	} else {
+		db = db.Where("username = ?", req.Username)
+	}
+	if err := db.First(&user).Error; err == nil && user.Email != "" {
+		// Send in the background so response time doesn't reveal the account exists
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			if err := sendPasswordReset(ctx, &user); err != nil {
+				logger.FromContext(ctx).Error("failed to send password reset", "user_id", user.ID, "error", err)
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists, a password reset link has been sent",
+	})
+}
+
+func sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := security.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	ttl := passwordResetTTL()
+	reset := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: security.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := config.DB.WithContext(ctx).Create(&reset).Error; err != nil {
+		return err
+	}
+
+	link := appURL() + "/reset-password?token=" + token
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you did not request this, you can ignore this email.\n",
+			user.Username, int(ttl.Minutes()), link),
+	})
+}
+
+// ResetPassword handles POST /api/password/reset with a token from the email
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var reset models.PasswordResetToken
+	err := requestDB(r).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		security.HashToken(req.Token), time.Now()).First(&reset).Error
+	if err != nil {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := requestDB(r).First(&user, reset.UserID).Error; err != nil {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	if err := security.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		writePasswordPolicyError(w, err)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	err = requestDB(r).Transaction(func(tx *gorm.DB) error {
+		// Mark the token used; the used_at guard makes concurrent redemption lose
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&user).Update("password", string(hashed)).Error; err != nil {
+			return err
+		}
+
+		// Any other outstanding links for this user are now stale
+		return tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "reset_password", "user", user.ID, nil, nil)
+
+	// A successful reset also lifts any login lockout on the account and
+	// signs out every existing session
+	security.ClearLockout(security.UserKey(user.Username))
+	security.RevokeUserSessions(user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"wwb99/config"
+	"wwb99/audit"
 	"wwb99/models"
+	"wwb99/security"
+
+	"gorm.io/gorm"
 )
 
 // Request body structure
@@ -18,7 +21,7 @@ type AssignPermissionsRequest struct {
 
 func AssignPermissions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	db := config.DB
+	db := requestDB(r)
 
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -44,7 +47,7 @@ func AssignPermissions(w http.ResponseWriter, r *http.Request) {
 
 	// Check if role exists
 	var role models.Role
-	if err := db.First(&role, req.ID).Error; err != nil {
+	if err := db.Preload("Permissions").First(&role, req.ID).Error; err != nil {
 		http.Error(w, "Role not found", http.StatusNotFound)
 		return
 	}
@@ -73,7 +76,23 @@ func AssignPermissions(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	tx.Commit()
+	stale, err := security.InvalidateRolePermissions(tx, req.ID)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "Failed to update permission version", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "Failed to assign permissions", http.StatusInternalServerError)
+		return
+	}
+	security.EvictRolePermissions(stale...)
+
+	updated := role
+	db.Preload("Permissions").First(&updated, role.ID)
+	audit.Record(r, "assign", "role", role.ID,
+		map[string]interface{}{"permissions": permissionNames(role.Permissions)},
+		map[string]interface{}{"permissions": permissionNames(updated.Permissions)})
 
 	// Return success response
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -84,6 +103,14 @@ func AssignPermissions(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func permissionNames(permissions []models.Permission) []string {
+	names := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
 // GetPermissions returns paginated permissions with search/sorting
 func GetPermissions(w http.ResponseWriter, r *http.Request) {
 	var permissions []models.Permission
@@ -107,7 +134,7 @@ func GetPermissions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	offset := (page - 1) * limit
-	db := config.DB.Model(&models.Permission{})
+	db := requestDB(r).Model(&models.Permission{})
 
 	// Search by name
 	if search != "" {
@@ -164,10 +191,11 @@ func CreatePermission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Create(&permission).Error; err != nil {
+	if err := requestDB(r).Create(&permission).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "create", "permission", permission.ID, nil, permission)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -191,18 +219,30 @@ func UpdatePermission(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var existing models.Permission
-	if err := config.DB.First(&existing, permission.ID).Error; err != nil {
+	if err := requestDB(r).First(&existing, permission.ID).Error; err != nil {
 		http.Error(w, "Permission not found", http.StatusNotFound)
 		return
 	}
 
-	err := config.DB.Model(&existing).Updates(models.Permission{
-		Name: permission.Name,
-	}).Error
+	before := existing
+	var stale []uint
+	err := requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existing).Updates(models.Permission{
+			Name: permission.Name,
+		}).Error; err != nil {
+			return err
+		}
+		// Roles holding a renamed permission must be re-evaluated
+		var err error
+		stale, err = security.InvalidateRolesWithPermission(tx, existing.ID)
+		return err
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	security.EvictRolePermissions(stale...)
+	audit.Record(r, "update", "permission", existing.ID, before, existing)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Permission updated successfully"})
@@ -216,16 +256,26 @@ func DeletePermission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := config.DB.Delete(&models.Permission{}, id)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	var permission models.Permission
+	if err := requestDB(r).First(&permission, id).Error; err != nil {
+		http.Error(w, "Permission not found or already deleted", http.StatusNotFound)
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		http.Error(w, "Permission not found or already deleted", http.StatusNotFound)
+	var stale []uint
+	err := requestDB(r).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if stale, err = security.InvalidateRolesWithPermission(tx, permission.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&permission).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	security.EvictRolePermissions(stale...)
+	audit.Record(r, "delete", "permission", permission.ID, permission, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Permission deleted successfully"})
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"wwb99/audit"
+	"wwb99/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// reorder handles PUT /api/{resource}/reorder with {"ids": [3, 1, 2]}. The
+// listed rows get positions 1..n in that order inside one transaction; rows
+// not listed keep their position. model is a pointer to the GORM model and
+// event the webhook event emitted on success.
+func reorder(w http.ResponseWriter, r *http.Request, model interface{}, resourceType, event string) {
+	var req struct {
+		IDs []uint `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		http.Error(w, "Request body must be {\"ids\": [...]}", http.StatusBadRequest)
+		return
+	}
+
+	seen := make(map[uint]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			http.Error(w, fmt.Sprintf("Duplicate ID %d", id), http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+
+	var before []struct {
+		ID       uint `json:"id"`
+		Position int  `json:"position"`
+	}
+	err := requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Select("id", "position").Where("id IN ?", req.IDs).
+			Order("position ASC, id ASC").Scan(&before).Error; err != nil {
+			return err
+		}
+		if len(before) != len(req.IDs) {
+			return gorm.ErrRecordNotFound
+		}
+
+		for i, id := range req.IDs {
+			if err := tx.Model(model).Where("id = ?", id).UpdateColumn("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		http.Error(w, "One or more IDs do not exist", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	beforeIDs := make([]uint, 0, len(before))
+	for _, row := range before {
+		beforeIDs = append(beforeIDs, row.ID)
+	}
+	audit.Record(r, "reorder", resourceType, "",
+		map[string]interface{}{"ids": beforeIDs},
+		map[string]interface{}{"ids": req.IDs})
+	webhooks.Emit(event, map[string]interface{}{"ids": req.IDs})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Order updated successfully",
+		"ids":     req.IDs,
+	})
+}
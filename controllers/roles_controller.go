@@ -2,12 +2,16 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
-	"wwb99/config"
+	"wwb99/audit"
+	"wwb99/logger"
 	"wwb99/models"
+	"wwb99/security"
 
 	"gorm.io/gorm"
 )
@@ -20,7 +24,7 @@ type Response struct {
 
 // GetPermissions handles GET /api/permissions or /api/roles/get?id=...
 func GetPermissionRoles(w http.ResponseWriter, r *http.Request) {
-	db := config.DB // Assuming config.DB is your *gorm.DB
+	db := requestDB(r) // Assuming requestDB(r) is your *gorm.DB
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -79,9 +83,22 @@ func GetRoleByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch role with associated permissions
+	// Fetch role with associated permissions and parent, or the
+	// associations named by ?include=
+	includes := []string{"Permissions", "Parent"}
+	if r.URL.Query().Has("include") {
+		if includes, err = parseIncludes(r, roleIncludes); err != nil {
+			listError(w, err)
+			return
+		}
+	}
+	db := requestDB(r)
+	for _, assoc := range includes {
+		db = db.Preload(assoc)
+	}
+
 	var role models.Role
-	if err := config.DB.Preload("Permissions").First(&role, id).Error; err != nil {
+	if err := db.First(&role, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "Role not found", http.StatusNotFound)
 			return
@@ -99,28 +116,34 @@ func GetRoleByID(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetRoles returns roles with permissions (paginated, searchable, sortable)
+// GetRoles returns roles (paginated, searchable, sortable). Associations
+// are chosen with ?include=permissions,parent; without ?include= permissions
+// are included as before.
 func GetRoles(w http.ResponseWriter, r *http.Request) {
-	var roles []models.Role
-
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	search := r.URL.Query().Get("search")
-	sortField := r.URL.Query().Get("sortBy")
-	order := r.URL.Query().Get("order")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	list, err := parseListing(r, listOptions{
+		defaultLimit: 10,
+		sorts: map[string]bool{
+			"id":         true,
+			"name":       true,
+			"created_at": true,
+		},
+		defaultSort: "created_at",
+	})
+	if err != nil {
+		listError(w, err)
+		return
 	}
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 10
+	includes := []string{"Permissions"}
+	if r.URL.Query().Has("include") {
+		if includes, err = parseIncludes(r, roleIncludes); err != nil {
+			listError(w, err)
+			return
+		}
 	}
 
-	offset := (page - 1) * limit
-	db := config.DB.Model(&models.Role{}).Preload("Permissions")
+	search := r.URL.Query().Get("search")
+	db := requestDB(r).Model(&models.Role{})
 
 	// Search
 	if search != "" {
@@ -131,39 +154,21 @@ func GetRoles(w http.ResponseWriter, r *http.Request) {
 	var total int64
 	db.Count(&total)
 
-	// Sorting
-	validSortFields := map[string]bool{
-		"id":         true,
-		"name":       true,
-		"created_at": true,
-	}
-	if !validSortFields[sortField] {
-		sortField = "created_at"
-	}
-	if strings.ToLower(order) != "asc" {
-		order = "desc"
-	}
-
-	result := db.Order(sortField + " " + order).
-		Limit(limit).
-		Offset(offset).
-		Find(&roles)
-
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	db = list.preload(db, includes, "parent_id")
+	roles, info, err := findPage[models.Role](list, db)
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	response := map[string]interface{}{
-		"data":       roles,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(list.response(roles, total, info))
+}
+
+// roleIncludes are the associations ?include= can load on roles
+var roleIncludes = map[string]string{
+	"permissions": "Permissions",
+	"parent":      "Parent",
 }
 
 // CreateRole creates a new role with permissions
@@ -174,12 +179,18 @@ func CreateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Create(&role).Error; err != nil {
+	if err := security.ValidateRoleParent(requestDB(r), 0, role.ParentID); err != nil {
+		http.Error(w, "Invalid parent role", http.StatusBadRequest)
+		return
+	}
+
+	if err := requestDB(r).Create(&role).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	config.DB.Preload("Permissions").First(&role, role.ID)
+	requestDB(r).Preload("Permissions").First(&role, role.ID)
+	audit.Record(r, "create", "role", role.ID, nil, role)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -188,10 +199,18 @@ func CreateRole(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// UpdateRole updates role name and permissions
+// UpdateRole updates a role's name, 2FA policy, parent and permissions.
+// Omitted fields keep their current values; "parent_id": null clears the
+// parent and permissions are only replaced when a non-empty list is sent.
 func UpdateRole(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var role models.Role
-	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+	if err := json.Unmarshal(body, &role); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -202,28 +221,65 @@ func UpdateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var existing models.Role
-	if err := config.DB.Preload("Permissions").First(&existing, role.ID).Error; err != nil {
+	if err := requestDB(r).Preload("Permissions").First(&existing, role.ID).Error; err != nil {
 		http.Error(w, "Role not found", http.StatusNotFound)
 		return
 	}
 
-	// Update role name
-	existing.Name = role.Name
+	before := existing
+	updated := existing
+	if err := json.Unmarshal(body, &updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parentChanged := (existing.ParentID == nil) != (updated.ParentID == nil) ||
+		(existing.ParentID != nil && *existing.ParentID != *updated.ParentID)
 
-	// Replace permissions
-	if len(role.Permissions) > 0 {
-		if err := config.DB.Model(&existing).Association("Permissions").Replace(role.Permissions); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	// Update role name, parent, 2FA policy and permissions together
+	var stale []uint
+	err = requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if parentChanged {
+			if err := security.ValidateRoleParent(tx, existing.ID, updated.ParentID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&existing).Select("Name", "Require2FA", "ParentID").Updates(models.Role{
+			Name:       updated.Name,
+			Require2FA: updated.Require2FA,
+			ParentID:   updated.ParentID,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Replace permissions
+		if len(role.Permissions) > 0 {
+			if err := tx.Model(&existing).Association("Permissions").Replace(role.Permissions); err != nil {
+				return err
+			}
 		}
-	}
 
-	if err := config.DB.Save(&existing).Error; err != nil {
+		if len(role.Permissions) > 0 || parentChanged {
+			var err error
+			stale, err = security.InvalidateRolePermissions(tx, existing.ID)
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, security.ErrRoleCycle) || errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Invalid parent role", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	security.EvictRolePermissions(stale...)
 
-	config.DB.Preload("Permissions").First(&existing, existing.ID)
+	requestDB(r).Preload("Permissions").First(&existing, existing.ID)
+	audit.Record(r, "update", "role", existing.ID, before, existing)
+	requestDB(r).Preload("Parent").First(&existing, existing.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -240,7 +296,19 @@ func DeleteRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := config.DB.Delete(&models.Role{}, id)
+	roleID, err := strconv.Atoi(id)
+	if err != nil || roleID <= 0 {
+		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		return
+	}
+
+	var existing models.Role
+	if err := requestDB(r).Preload("Permissions").First(&existing, roleID).Error; err != nil {
+		http.Error(w, "Role not found or already deleted", http.StatusNotFound)
+		return
+	}
+
+	result := requestDB(r).Delete(&models.Role{}, roleID)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
@@ -251,6 +319,15 @@ func DeleteRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Drop cached permissions so tokens carrying this role lose access at once
+	stale, err := security.InvalidateRolePermissions(requestDB(r), uint(roleID))
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to invalidate role permissions", "role_id", roleID, "error", err)
+		stale = []uint{uint(roleID)}
+	}
+	security.EvictRolePermissions(stale...)
+	audit.Record(r, "delete", "role", existing.ID, existing, nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Role deleted successfully"})
 }
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wwb99/config"
+	"wwb99/models"
+)
+
+func TestUpdateRolePartial(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     map[string]interface{}
+		wantName   string
+		want2FA    bool
+		wantParent bool
+	}{
+		{"rename only", map[string]interface{}{"name": "administrators"}, "administrators", true, true},
+		{"2fa only", map[string]interface{}{"require_2fa": false}, "admin", false, true},
+		{"clear parent", map[string]interface{}{"parent_id": nil}, "admin", true, false},
+		{"no fields", map[string]interface{}{}, "admin", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := config.DB
+			config.DB = memoryDB(t, &models.Role{}, &models.Permission{}, &models.AuditLog{})
+			t.Cleanup(func() { config.DB = prev })
+
+			editor := models.Role{Name: "editor"}
+			config.DB.Create(&editor)
+			admin := models.Role{Name: "admin", Require2FA: true, ParentID: &editor.ID}
+			config.DB.Create(&admin)
+
+			tt.fields["ID"] = admin.ID
+			body, _ := json.Marshal(tt.fields)
+			w := httptest.NewRecorder()
+			UpdateRole(w, httptest.NewRequest("PUT", "/api/roles", bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var got models.Role
+			config.DB.First(&got, admin.ID)
+			if got.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", got.Name, tt.wantName)
+			}
+			if got.Require2FA != tt.want2FA {
+				t.Errorf("require_2fa = %v, want %v", got.Require2FA, tt.want2FA)
+			}
+			if (got.ParentID != nil && *got.ParentID == editor.ID) != tt.wantParent {
+				t.Errorf("parent_id = %v, want editor: %v", got.ParentID, tt.wantParent)
+			}
+
+			var entries int64
+			config.DB.Model(&models.AuditLog{}).Where("action = ? AND resource_type = ?", "update", "role").Count(&entries)
+			if entries != 1 {
+				t.Errorf("audit entries = %d, want 1", entries)
+			}
+		})
+	}
+}
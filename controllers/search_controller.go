@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/i18n"
+	"wwb99/search"
+)
+
+// Search runs a ranked full-text query across published content.
+//
+//	q         search text (required)
+//	type      comma separated: news, highlights (default all)
+//	category  news category
+//	from, to  creation date range, YYYY-MM-DD or RFC 3339
+//	page, limit
+//
+// Matches in the requested language (?lang= or Accept-Language) rank first.
+// Titles and snippets are HTML-escaped with matches wrapped in <mark>.
+func Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	text := strings.TrimSpace(q.Get("q"))
+	if text == "" {
+		http.Error(w, "'q' query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	query := search.Query{
+		Text:     text,
+		Category: q.Get("category"),
+		Locale:   i18n.FromRequest(r),
+		Limit:    limit,
+		Offset:   (page - 1) * limit,
+	}
+
+	if v := q.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !search.Searchable(t) {
+				http.Error(w, "Invalid type, use one of: "+strings.Join(search.Types, ", "), http.StatusBadRequest)
+				return
+			}
+			query.Types = append(query.Types, t)
+		}
+	}
+	if v := q.Get("from"); v != "" {
+		if query.From, err = parseDateParam(v); err != nil {
+			http.Error(w, "Invalid date filter, use YYYY-MM-DD or RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if query.To, err = parseDateParam(v); err != nil {
+			http.Error(w, "Invalid date filter, use YYYY-MM-DD or RFC 3339", http.StatusBadRequest)
+			return
+		}
+		// A bare date includes the whole day
+		if len(v) == len("2006-01-02") {
+			query.To = query.To.Add(24 * time.Hour)
+		}
+	}
+
+	result, err := search.Default.Search(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data":       result.Hits,
+		"total":      result.Total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": (result.Total + limit - 1) / limit,
+	}
+
+	i18n.SetHeaders(w, query.Locale)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
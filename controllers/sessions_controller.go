@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wwb99/audit"
+	"wwb99/models"
+	"wwb99/security"
+)
+
+// sessionView is a session as shown to its owner
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func activeSessions(r *http.Request, userID, currentID uint) ([]sessionView, error) {
+	var sessions []models.Session
+	err := requestDB(r).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{Session: s, Current: s.ID == currentID})
+	}
+	return views, nil
+}
+
+// GetSessions lists the logged-in user's active sessions
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(uint)
+	sessionID, _ := r.Context().Value("session_id").(uint)
+
+	sessions, err := activeSessions(r, userID, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Success",
+		"data":    sessions,
+	})
+}
+
+// RevokeSession handles DELETE /api/profile/sessions?id= for one of the
+// user's own sessions, or ?others=true to sign out everywhere else
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(uint)
+	currentID, _ := r.Context().Value("session_id").(uint)
+
+	if r.URL.Query().Get("others") == "true" {
+		count, err := security.RevokeUserSessions(userID, currentID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit.Record(r, "revoke_others", "session", currentID, nil, map[string]interface{}{"revoked": count})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Other sessions revoked successfully",
+			"revoked": count,
+		})
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Missing or invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := security.RevokeSession(userID, uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Session not found or already revoked", http.StatusNotFound)
+		return
+	}
+	audit.Record(r, "revoke", "session", id, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked successfully"})
+}
+
+// Logout revokes the session the request was made with
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(uint)
+	sessionID, _ := r.Context().Value("session_id").(uint)
+
+	if _, err := security.RevokeSession(userID, sessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	security.ClearRefreshCookie(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// GetUserSessions lists another user's active sessions (?user_id=)
+func GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "Missing or invalid user_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := activeSessions(r, uint(userID), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Success",
+		"data":    sessions,
+	})
+}
+
+// TerminateUserSessions revokes every session of a user (?user_id=), signing
+// them out on all devices
+func TerminateUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "Missing or invalid user_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := requestDB(r).First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	count, err := security.RevokeUserSessions(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "terminate_sessions", "user", user.ID, nil, map[string]interface{}{"revoked": count})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Sessions terminated successfully",
+		"revoked": count,
+	})
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/i18n"
+	"wwb99/models"
+)
+
+type sitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapURL struct {
+	Loc        string        `xml:"loc"`
+	LastMod    string        `xml:"lastmod,omitempty"`
+	Alternates []sitemapLink `xml:"xhtml:link"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Xhtml   string       `xml:"xmlns:xhtml,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapPath is the frontend path pattern for a content type, with {id}
+// replaced by the item ID (SITEMAP_NEWS_PATH, SITEMAP_HIGHLIGHTS_PATH)
+func sitemapPath(env, def string, id uint) string {
+	pattern := os.Getenv(env)
+	if pattern == "" {
+		pattern = def
+	}
+	return strings.ReplaceAll(pattern, "{id}", strconv.FormatUint(uint64(id), 10))
+}
+
+// localizedURL lists loc in every locale it is available in, plus x-default.
+// Locales are selected on the frontend with ?lang=.
+func localizedURL(loc string, lastMod time.Time, locales []string) sitemapURL {
+	sep := "?"
+	if strings.Contains(loc, "?") {
+		sep = "&"
+	}
+
+	u := sitemapURL{Loc: loc}
+	if !lastMod.IsZero() {
+		u.LastMod = lastMod.Format("2006-01-02")
+	}
+	for _, l := range locales {
+		u.Alternates = append(u.Alternates, sitemapLink{Rel: "alternate", Hreflang: l, Href: loc + sep + "lang=" + l})
+	}
+	u.Alternates = append(u.Alternates, sitemapLink{Rel: "alternate", Hreflang: "x-default", Href: loc})
+	return u
+}
+
+// GetSitemap serves /sitemap.xml with hreflang alternates for every
+// translated locale of each news item and highlight
+func GetSitemap(w http.ResponseWriter, r *http.Request) {
+	base := appURL()
+	set := sitemapURLSet{
+		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		Xhtml: "http://www.w3.org/1999/xhtml",
+		URLs:  []sitemapURL{localizedURL(base+"/", time.Time{}, i18n.Locales)},
+	}
+
+	var news []models.News
+	if err := requestDB(r).Select("id", "updated_at").Order("id DESC").Find(&news).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var highlights []models.Highlights
+	if err := requestDB(r).Select("id", "updated_at").Order("id DESC").Find(&highlights).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	newsIDs := make([]uint, 0, len(news))
+	for _, n := range news {
+		newsIDs = append(newsIDs, uint(n.ID))
+	}
+	highlightIDs := make([]uint, 0, len(highlights))
+	for _, h := range highlights {
+		highlightIDs = append(highlightIDs, uint(h.ID))
+	}
+
+	newsLocales, err := i18n.AvailableLocales("news", newsIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	highlightLocales, err := i18n.AvailableLocales("highlights", highlightIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, n := range news {
+		id := uint(n.ID)
+		set.URLs = append(set.URLs, localizedURL(base+sitemapPath("SITEMAP_NEWS_PATH", "/news/{id}", id), n.UpdatedAt, newsLocales[id]))
+	}
+	for _, h := range highlights {
+		id := uint(h.ID)
+		set.URLs = append(set.URLs, localizedURL(base+sitemapPath("SITEMAP_HIGHLIGHTS_PATH", "/highlights/{id}", id), h.UpdatedAt, highlightLocales[id]))
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(set)
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/analytics"
+	"wwb99/logger"
+	"wwb99/models"
+	"wwb99/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// maxImpressionIDs caps how many sponsors one beacon can count
+const maxImpressionIDs = 50
+
+// transparentGIF is a 1x1 pixel for <img> impression beacons
+var transparentGIF, _ = base64.StdEncoding.DecodeString("R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")
+
+// apiURL is the public base URL of this API, used to build tracking links.
+// API_URL overrides what is derived from the request.
+func apiURL(r *http.Request) string {
+	if u := os.Getenv("API_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || (os.Getenv("TRUST_PROXY") == "true" && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// sponsorPlacement is a sponsor as served to the site, with tracking links
+type sponsorPlacement struct {
+	models.Sponsors
+	ClickURL      string `json:"click_url"`
+	ImpressionURL string `json:"impression_url"`
+}
+
+func withTracking(r *http.Request, sponsors []models.Sponsors) []sponsorPlacement {
+	base := apiURL(r)
+	placements := make([]sponsorPlacement, 0, len(sponsors))
+	for _, s := range sponsors {
+		id := strconv.FormatUint(uint64(s.ID), 10)
+		placements = append(placements, sponsorPlacement{
+			Sponsors:      s,
+			ClickURL:      base + "/go/sponsor/" + id + "?slot=" + url.QueryEscape(s.Slot),
+			ImpressionURL: base + "/api/sponsors/impression?id=" + id + "&slot=" + url.QueryEscape(s.Slot),
+		})
+	}
+	return placements
+}
+
+// SponsorRedirect handles GET /go/sponsor/{id}: it logs the click and
+// redirects to the sponsor's target
+func SponsorRedirect(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var sponsor models.Sponsors
+	if err := requestDB(r).First(&sponsor, id).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	target, err := url.Parse(sponsor.Redirect)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	slot := r.URL.Query().Get("slot")
+	if !models.ValidSponsorSlot(slot) {
+		slot = sponsor.Slot
+	}
+
+	now := time.Now()
+	click := models.SponsorClick{
+		SponsorID: sponsor.ID,
+		Slot:      slot,
+		Referrer:  r.Referer(),
+		IPHash:    analytics.HashIP(utils.ClientIP(r), now),
+		UserAgent: r.UserAgent(),
+		IsBot:     analytics.IsBot(r.UserAgent()),
+		CreatedAt: now,
+	}
+	if err := analytics.RecordClick(&click); err != nil {
+		logger.FromContext(r.Context()).Error("failed to record sponsor click", "sponsor_id", sponsor.ID, "error", err)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "origin")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// SponsorImpression counts impressions for ?id= (repeatable or comma
+// separated). GET answers with a 1x1 GIF for <img> beacons, POST with 204 for
+// navigator.sendBeacon.
+func SponsorImpression(w http.ResponseWriter, r *http.Request) {
+	var ids []uint
+	for _, v := range r.URL.Query()["id"] {
+		for _, part := range strings.Split(v, ",") {
+			if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && id > 0 && len(ids) < maxImpressionIDs {
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+
+	if len(ids) > 0 {
+		// Only count sponsors that exist
+		var known []uint
+		requestDB(r).Model(&models.Sponsors{}).Where("id IN ?", ids).Pluck("id", &known)
+		if err := analytics.RecordImpressions(known, analytics.IsBot(r.UserAgent()), time.Now()); err != nil {
+			logger.FromContext(r.Context()).Error("failed to record sponsor impressions", "error", err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "image/gif")
+		w.Write(transparentGIF)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reportRange reads ?from= and ?to= (YYYY-MM-DD), defaulting to the last 30
+// days, and ?sponsor_id=
+func reportRange(r *http.Request) (from, to time.Time, sponsorID uint, ok bool) {
+	q := r.URL.Query()
+	to = time.Now()
+	from = to.AddDate(0, 0, -29)
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return from, to, 0, false
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return from, to, 0, false
+		}
+	}
+	if to.Before(from) {
+		return from, to, 0, false
+	}
+	if v := q.Get("sponsor_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			return from, to, 0, false
+		}
+		sponsorID = uint(id)
+	}
+
+	// Today's clicks are only rolled up periodically; refresh before reporting
+	if !time.Now().Before(from) {
+		if err := analytics.RollupDay(time.Now()); err != nil {
+			logger.FromContext(r.Context()).Error("failed to refresh sponsor stats", "error", err)
+		}
+	}
+	return from, to, sponsorID, true
+}
+
+// GetSponsorReport returns impressions, clicks and CTR per sponsor over
+// ?from=..?to=, plus the daily breakdown
+func GetSponsorReport(w http.ResponseWriter, r *http.Request) {
+	from, to, sponsorID, ok := reportRange(r)
+	if !ok {
+		http.Error(w, "Invalid from, to or sponsor_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	report, err := analytics.Report(from, to, sponsorID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	daily, err := analytics.Daily(from, to, sponsorID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Success",
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"data":    report,
+		"daily":   daily,
+	})
+}
+
+// ExportSponsorReport streams the report as CSV; ?group=day exports one row
+// per sponsor per day instead of totals
+func ExportSponsorReport(w http.ResponseWriter, r *http.Request) {
+	from, to, sponsorID, ok := reportRange(r)
+	if !ok {
+		http.Error(w, "Invalid from, to or sponsor_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	filename := "sponsors-" + from.Format("20060102") + "-" + to.Format("20060102") + ".csv"
+	formatInt := func(n int64) string { return strconv.FormatInt(n, 10) }
+	ctr := func(clicks, impressions int64) string {
+		if impressions == 0 {
+			return "0.00"
+		}
+		return strconv.FormatFloat(float64(clicks)/float64(impressions)*100, 'f', 2, 64)
+	}
+
+	if r.URL.Query().Get("group") == "day" {
+		daily, err := analytics.Daily(from, to, sponsorID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"date", "sponsor_id", "impressions", "clicks", "unique_clicks", "ctr_percent", "bot_impressions", "bot_clicks"})
+		for _, s := range daily {
+			cw.Write([]string{
+				s.Date.Format("2006-01-02"),
+				strconv.FormatUint(uint64(s.SponsorID), 10),
+				formatInt(s.Impressions),
+				formatInt(s.Clicks),
+				formatInt(s.UniqueClicks),
+				ctr(s.Clicks, s.Impressions),
+				formatInt(s.BotImpressions),
+				formatInt(s.BotClicks),
+			})
+		}
+		cw.Flush()
+		return
+	}
+
+	report, err := analytics.Report(from, to, sponsorID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"sponsor_id", "name", "slot", "impressions", "clicks", "unique_clicks", "ctr_percent", "bot_impressions", "bot_clicks"})
+	for _, s := range report {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(s.SponsorID), 10),
+			csvSafe(s.Name),
+			s.Slot,
+			formatInt(s.Impressions),
+			formatInt(s.Clicks),
+			formatInt(s.UniqueClicks),
+			ctr(s.Clicks, s.Impressions),
+			formatInt(s.BotImpressions),
+			formatInt(s.BotClicks),
+		})
+	}
+	cw.Flush()
+}
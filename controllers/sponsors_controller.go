@@ -2,51 +2,132 @@ package controllers
 
 import (
 	"encoding/json"
+	"io"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"sort"
 	"strconv"
-	"strings"
-	"wwb99/config"
+	"time"
+	"wwb99/audit"
+	"wwb99/i18n"
 	"wwb99/models"
+	"wwb99/webhooks"
+
+	"gorm.io/gorm"
 )
 
+// liveSponsors restricts db to campaigns that are active and within their
+// schedule at now
+func liveSponsors(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("status = ? AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)",
+		models.SponsorStatusActive, now, now)
+}
+
+// rotateSponsors orders sponsors by priority, then manual position (unset
+// last), and shuffles sponsors sharing both by weight, so a sponsor with
+// twice the weight leads its group twice as often
+func rotateSponsors(sponsors []models.Sponsors) []models.Sponsors {
+	keys := make(map[uint]float64, len(sponsors))
+	for _, s := range sponsors {
+		weight := math.Max(float64(s.Weight), 1)
+		// Efraimidis–Spirakis: smallest -ln(u)/w wins
+		keys[s.ID] = -math.Log(1-rand.Float64()) / weight
+	}
+	sort.SliceStable(sponsors, func(i, j int) bool {
+		if sponsors[i].Priority != sponsors[j].Priority {
+			return sponsors[i].Priority > sponsors[j].Priority
+		}
+		if pi, pj := sponsors[i].Position, sponsors[j].Position; pi != pj {
+			// Unordered (position 0) sponsors follow the manually ordered ones
+			if pi == 0 || pj == 0 {
+				return pj == 0
+			}
+			return pi < pj
+		}
+		return keys[sponsors[i].ID] < keys[sponsors[j].ID]
+	})
+	return sponsors
+}
+
+// GetSponsorsHome returns the sponsors currently live, grouped by slot and
+// weighted-rotated. ?slot= returns a single slot as a list and ?limit= caps
+// the sponsors per slot.
 func GetSponsorsHome(w http.ResponseWriter, r *http.Request) {
+	db := liveSponsors(requestDB(r), time.Now())
+
+	slot := r.URL.Query().Get("slot")
+	if slot != "" {
+		if !models.ValidSponsorSlot(slot) {
+			http.Error(w, "Invalid slot, use header, sidebar or footer", http.StatusBadRequest)
+			return
+		}
+		db = db.Where("slot = ?", slot)
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
 	var sponsors []models.Sponsors
-	result := config.DB.Order("created_at DESC").Find(&sponsors)
+	result := db.Find(&sponsors)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	localize(w, r, sponsors)
+
+	grouped := map[string][]models.Sponsors{}
+	for _, s := range sponsors {
+		grouped[s.Slot] = append(grouped[s.Slot], s)
+	}
+
+	// Each sponsor carries click and impression tracking links
+	bySlot := map[string][]sponsorPlacement{}
+	for _, s := range models.SponsorSlots {
+		list := rotateSponsors(grouped[s])
+		if limit > 0 && len(list) > limit {
+			list = list[:limit]
+		}
+		bySlot[s] = withTracking(r, list)
+	}
+
+	var data interface{} = bySlot
+	if slot != "" {
+		data = bySlot[slot]
+	}
+
+	// The order changes on every request, so it must not be cached
+	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Success",
-		"data":    sponsors,
+		"data":    data,
 	})
 }
 
 // Get all sponsors with pagination, search, sorting
 func GetSponsors(w http.ResponseWriter, r *http.Request) {
-	var sponsors []models.Sponsors
-
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	search := r.URL.Query().Get("search")
-	sortField := r.URL.Query().Get("sortBy")
-	order := r.URL.Query().Get("order")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		http.Error(w, "'page' query parameter is required and must be a positive integer", http.StatusBadRequest)
-		return
-	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		http.Error(w, "'limit' query parameter is required and must be a positive integer", http.StatusBadRequest)
+	list, err := parseListing(r, listOptions{
+		requirePage: true,
+		sorts: map[string]bool{
+			"id":         true,
+			"name":       true,
+			"created_at": true,
+			"position":   true,
+			"priority":   true,
+			"weight":     true,
+			"starts_at":  true,
+			"ends_at":    true,
+		},
+		defaultSort: "created_at",
+	})
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	offset := (page - 1) * limit
-	db := config.DB.Model(&models.Sponsors{})
+	search := r.URL.Query().Get("search")
+	db := requestDB(r).Model(&models.Sponsors{})
 
 	// Search by name or redirect
 	if search != "" {
@@ -54,44 +135,36 @@ func GetSponsors(w http.ResponseWriter, r *http.Request) {
 		db = db.Where("name LIKE ? OR redirect LIKE ?", likeQuery, likeQuery)
 	}
 
-	var total int64
-	db.Count(&total)
-
-	validSortFields := map[string]bool{
-		"id":         true,
-		"name":       true,
-		"created_at": true,
+	// Campaign filters
+	if slot := r.URL.Query().Get("slot"); slot != "" {
+		db = db.Where("slot = ?", slot)
 	}
-
-	if !validSortFields[sortField] {
-		sortField = "created_at"
+	if status := r.URL.Query().Get("status"); status != "" {
+		db = db.Where("status = ?", status)
 	}
-
-	order = strings.ToLower(order)
-	if order != "asc" {
-		order = "desc"
+	now := time.Now()
+	switch r.URL.Query().Get("state") {
+	case "live":
+		db = liveSponsors(db, now)
+	case "scheduled":
+		db = db.Where("starts_at > ?", now)
+	case "ended":
+		db = db.Where("ends_at <= ?", now)
 	}
 
-	result := db.Order(sortField + " " + order).
-		Limit(limit).
-		Offset(offset).
-		Find(&sponsors)
+	var total int64
+	db.Count(&total)
 
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	sponsors, info, err := findPage[models.Sponsors](list, db)
+	if err != nil {
+		listError(w, err)
 		return
 	}
 
-	response := map[string]interface{}{
-		"data":       sponsors,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int((total + int64(limit) - 1) / int64(limit)),
-	}
+	localizeExplicit(w, r, sponsors)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(list.response(sponsors, total, info))
 }
 
 // Get sponsor by ID
@@ -109,12 +182,14 @@ func GetSponsorByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var sponsor models.Sponsors
-	result := config.DB.First(&sponsor, id)
+	result := requestDB(r).First(&sponsor, id)
 	if result.Error != nil {
 		http.Error(w, "Sponsor not found", http.StatusNotFound)
 		return
 	}
 
+	localizeOneExplicit(w, r, &sponsor)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Success",
@@ -130,10 +205,18 @@ func CreateSponsor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Create(&sponsor).Error; err != nil {
+	sponsor.ID = 0
+	if err := sponsor.Normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := requestDB(r).Create(&sponsor).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, "create", "sponsors", sponsor.ID, nil, sponsor)
+	webhooks.Emit("sponsor.created", sponsor)
 
 	response := struct {
 		Message string          `json:"message"`
@@ -147,10 +230,17 @@ func CreateSponsor(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// UpdateSponsor applies the fields present in the body; omitted fields keep
+// their current values and null clears starts_at / ends_at
 func UpdateSponsor(w http.ResponseWriter, r *http.Request) {
-	var sponsor models.Sponsors
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&sponsor); err != nil {
+	var sponsor models.Sponsors
+	if err := json.Unmarshal(body, &sponsor); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -161,23 +251,39 @@ func UpdateSponsor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var existing models.Sponsors
-	if err := config.DB.First(&existing, sponsor.ID).Error; err != nil {
+	if err := requestDB(r).First(&existing, sponsor.ID).Error; err != nil {
 		http.Error(w, "Sponsor not found", http.StatusNotFound)
 		return
 	}
 
-	err := config.DB.Model(&existing).Updates(models.Sponsors{
-		Name:     sponsor.Name,
-		ImageURL: sponsor.ImageURL,
-		Redirect: sponsor.Redirect,
-	}).Error
+	before := existing
+	updated := existing
+	if err := json.Unmarshal(body, &updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated.ID, updated.CreatedAt = existing.ID, existing.CreatedAt
+	if err := updated.Normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = requestDB(r).Model(&existing).
+		Select("Name", "ImageURL", "Redirect", "Slot", "Status", "Priority", "Weight", "StartsAt", "EndsAt").
+		Updates(&updated).Error
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	requestDB(r).First(&existing, existing.ID)
+	audit.Record(r, "update", "sponsors", existing.ID, before, existing)
+	webhooks.Emit("sponsor.updated", existing)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Sponsor updated successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Sponsor updated successfully",
+		"data":    existing,
+	})
 }
 
 // Delete sponsor
@@ -188,7 +294,13 @@ func DeleteSponsor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := config.DB.Delete(&models.Sponsors{}, id)
+	var existing models.Sponsors
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "Sponsor not found or already deleted", http.StatusNotFound)
+		return
+	}
+
+	result := requestDB(r).Delete(&models.Sponsors{}, existing.ID)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
@@ -198,7 +310,15 @@ func DeleteSponsor(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Sponsor not found or already deleted", http.StatusNotFound)
 		return
 	}
+	audit.Record(r, "delete", "sponsors", existing.ID, existing, nil)
+	webhooks.Emit("sponsor.deleted", existing)
+	i18n.DeleteTranslations("sponsors", uint(existing.ID))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Sponsor deleted successfully"})
 }
+
+// ReorderSponsors sets the manual display order of sponsors
+func ReorderSponsors(w http.ResponseWriter, r *http.Request) {
+	reorder(w, r, &models.Sponsors{}, "sponsors", "sponsor.reordered")
+}
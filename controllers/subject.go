@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+
+	"wwb99/middleware"
+	"wwb99/models"
+	"wwb99/policy"
+)
+
+// requestSubject adapts the authenticated caller to policy.Subject
+type requestSubject struct {
+	r *http.Request
+}
+
+func (s requestSubject) UserID() uint {
+	id, _ := s.r.Context().Value("user_id").(uint)
+	return id
+}
+
+func (s requestSubject) HasPermission(name string) bool {
+	return middleware.HasPermission(s.r, name)
+}
+
+// allow evaluates the content policy for the current request
+func allow(r *http.Request, action string, resource policy.Resource) bool {
+	return policy.Allow(requestSubject{r}, action, resource)
+}
+
+// actor returns the ID and display name recorded as CreatedBy/UpdatedBy
+func actor(r *http.Request) (uint, string) {
+	if apiKey, ok := r.Context().Value("api_key").(*models.APIKey); ok {
+		return 0, "api-key:" + apiKey.Name
+	}
+
+	userID, ok := r.Context().Value("user_id").(uint)
+	if !ok {
+		return 0, ""
+	}
+
+	var user models.User
+	if err := requestDB(r).Select("id", "username").First(&user, userID).Error; err != nil {
+		return userID, ""
+	}
+	return userID, user.Username
+}
@@ -0,0 +1,641 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/audit"
+	"wwb99/i18n"
+	"wwb99/logger"
+	"wwb99/models"
+	"wwb99/richtext"
+	"wwb99/search"
+	"wwb99/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// Bulk import and export of content.
+//
+//	POST /api/{resource}/import?format=csv|jsonl&dry_run=true
+//	GET  /api/{resource}/export?format=csv|jsonl
+//
+// Imports take the file as the request body or as the "file" field of a
+// multipart form. The format comes from ?format=, the file extension or the
+// Content-Type. CSV needs a header row; JSON Lines has one object per line.
+// Every row is validated before anything is written: if any row fails, the
+// report lists the row errors and nothing is imported. Otherwise all rows
+// are created in one transaction. With dry_run=true only the report is
+// returned. Columns the resource doesn't import (id, updated_by, ...) are
+// ignored and listed as warnings, so exports can be imported again.
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// importLimits are IMPORT_MAX_BYTES (default 20 MiB) and IMPORT_MAX_ROWS
+// (default 5000)
+func importLimits() (maxBytes int64, maxRows int) {
+	maxBytes, maxRows = 20<<20, 5000
+	if n, err := strconv.ParseInt(os.Getenv("IMPORT_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		maxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("IMPORT_MAX_ROWS")); err == nil && n > 0 {
+		maxRows = n
+	}
+	return maxBytes, maxRows
+}
+
+// rowError is a validation failure in one row of an import
+type rowError struct {
+	Row   int    `json:"row"` // CSV line (the header is line 1) or JSON Lines line
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// record is one imported row: column name to raw value
+type record map[string]string
+
+func (rec record) str(name string) string {
+	return strings.TrimSpace(rec[name])
+}
+
+// text is str for fields that may contain meaningful surrounding whitespace
+func (rec record) text(name string) string {
+	return rec[name]
+}
+
+func (rec record) require(name string, errs *[]rowError) string {
+	v := rec.str(name)
+	if v == "" {
+		*errs = append(*errs, rowError{Field: name, Error: "is required"})
+	}
+	return v
+}
+
+func (rec record) int(name string, def int, errs *[]rowError) int {
+	v := rec.str(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		*errs = append(*errs, rowError{Field: name, Error: "must be an integer"})
+	}
+	return n
+}
+
+func (rec record) time(name string, errs *[]rowError) *time.Time {
+	v := rec.str(name)
+	if v == "" {
+		return nil
+	}
+	t, err := parseDateParam(v)
+	if err != nil {
+		*errs = append(*errs, rowError{Field: name, Error: "must be YYYY-MM-DD or RFC 3339"})
+		return nil
+	}
+	return &t
+}
+
+// transfer describes how one resource is imported and exported
+type transfer[T any] struct {
+	resource string
+	columns  []string // exported columns, in order; id and created_at come first
+	imports  []string // columns read on import
+
+	// parse validates a row into a new item
+	parse func(rec record) (*T, []rowError)
+	// author sets CreatedBy/UpdatedBy, for resources that record authorship
+	author func(item *T, id uint, name string)
+	// prepare runs write-time processing, such as the rich-text pipeline,
+	// just before the item is created
+	prepare func(r *http.Request, item *T) error
+	// saved runs after the transaction commits
+	saved func(r *http.Request, item *T)
+	// event is the webhook event emitted for each imported row
+	event string
+
+	id     func(item *T) uint
+	values func(item *T) []string // CSV cells for columns
+}
+
+// readImport returns the uploaded file and its format
+func readImport(r *http.Request) (io.Reader, string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	body := io.Reader(r.Body)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("multipart upload must have a \"file\" field")
+		}
+		body = file
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+	}
+
+	if format == "" {
+		switch mediaType {
+		case "text/csv":
+			format = formatCSV
+		case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+			format = formatJSONL
+		}
+	}
+	if format == "ndjson" {
+		format = formatJSONL
+	}
+	if format != formatCSV && format != formatJSONL {
+		return nil, "", errors.New("format must be csv or jsonl")
+	}
+	return body, format, nil
+}
+
+// readRecords decodes the file into records, keyed by their line number
+func readRecords(body io.Reader, format string, maxRows int) (rows []record, lines []int, columns []string, err error) {
+	seen := make(map[string]bool)
+	addColumn := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, name)
+		}
+	}
+
+	if format == formatCSV {
+		cr := csv.NewReader(body)
+		header, err := cr.Read()
+		if err != nil {
+			return nil, nil, nil, errors.New("CSV file must start with a header row")
+		}
+		for i, h := range header {
+			h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+			header[i] = h
+			addColumn(h)
+		}
+		for {
+			cells, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if len(rows) == maxRows {
+				return nil, nil, nil, fmt.Errorf("import is limited to %d rows", maxRows)
+			}
+			line, _ := cr.FieldPos(0)
+			rec := make(record, len(header))
+			for i, h := range header {
+				rec[h] = csvUnescape(cells[i])
+			}
+			rows, lines = append(rows, rec), append(lines, line)
+		}
+		return rows, lines, columns, nil
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, nil, nil, fmt.Errorf("import is limited to %d rows", maxRows)
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, nil, nil, fmt.Errorf("line %d is not a JSON object", line)
+		}
+		rec := make(record, len(obj))
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			name := strings.ToLower(key)
+			addColumn(name)
+			rec[name] = jsonScalar(obj[key])
+		}
+		rows, lines = append(rows, rec), append(lines, line)
+	}
+	return rows, lines, columns, scanner.Err()
+}
+
+// jsonScalar renders a JSON value as the text a CSV cell would hold
+func jsonScalar(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	if string(v) == "null" {
+		return ""
+	}
+	return string(v)
+}
+
+// csvUnescape reverses csvSafe so exported files import unchanged
+func csvUnescape(s string) string {
+	if strings.HasPrefix(s, "'") && csvSafe(s[1:]) == s {
+		return s[1:]
+	}
+	return s
+}
+
+func (t transfer[T]) importRows(w http.ResponseWriter, r *http.Request) {
+	maxBytes, maxRows := importLimits()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	body, format, err := readImport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, lines, columns, err := readRecords(body, format, maxRows)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Import file exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid "+format+" file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	var warnings []string
+	for _, c := range columns {
+		if !slices.Contains(t.imports, c) {
+			warnings = append(warnings, fmt.Sprintf("column %q is ignored", c))
+		}
+	}
+
+	// Validate every row before writing anything
+	items := make([]*T, 0, len(rows))
+	rowErrors := []rowError{}
+	byID, by := actor(r)
+	for i, rec := range rows {
+		item, errs := t.parse(rec)
+		if t.author != nil {
+			t.author(item, byID, by)
+		}
+		for _, e := range errs {
+			e.Row = lines[i]
+			rowErrors = append(rowErrors, e)
+		}
+		items = append(items, item)
+	}
+
+	report := map[string]interface{}{
+		"dry_run":  dryRun,
+		"format":   format,
+		"rows":     len(rows),
+		"valid":    len(rows) - countRows(rowErrors),
+		"errors":   rowErrors,
+		"warnings": warnings,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(rowErrors) > 0 {
+		report["message"] = "Import has errors; nothing was imported"
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	if len(rows) == 0 {
+		report["message"] = "Import file has no rows"
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	if dryRun {
+		report["message"] = "Dry run passed; no rows were imported"
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	// Write-time processing can still reject a row (e.g. an oversized
+	// embedded image); it is reported the same way as validation errors
+	for i, item := range items {
+		if t.prepare == nil {
+			break
+		}
+		if err := t.prepare(r, item); err != nil {
+			rowErrors = append(rowErrors, rowError{Row: lines[i], Error: err.Error()})
+		}
+	}
+	if len(rowErrors) > 0 {
+		report["errors"] = rowErrors
+		report["valid"] = len(rows) - countRows(rowErrors)
+		report["message"] = "Import has errors; nothing was imported"
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	failed := -1
+	err = requestDB(r).Transaction(func(tx *gorm.DB) error {
+		for i, item := range items {
+			if err := tx.Create(item).Error; err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if failed >= 0 {
+			report["errors"] = []rowError{{Row: lines[failed], Error: err.Error()}}
+			report["valid"] = 0
+		}
+		report["message"] = "Import failed; nothing was imported"
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = t.id(item)
+		if t.saved != nil {
+			t.saved(r, item)
+		}
+		webhooks.Emit(t.event, item)
+	}
+	audit.Record(r, "import", t.resource, "", nil, map[string]interface{}{"format": format, "count": len(ids), "ids": ids})
+
+	report["message"] = fmt.Sprintf("Imported %d rows", len(ids))
+	report["ids"] = ids
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// countRows counts the distinct rows with errors
+func countRows(errs []rowError) int {
+	rows := make(map[int]bool)
+	for _, e := range errs {
+		rows[e.Row] = true
+	}
+	return len(rows)
+}
+
+// exportRows streams every item, oldest first. JSON Lines carry the full
+// item; CSV carries the transfer columns with spreadsheet formulas
+// neutralised.
+func (t transfer[T]) exportRows(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = formatCSV
+	}
+	if format != formatCSV && format != formatJSONL {
+		http.Error(w, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := requestDB(r).Model(new(T)).Order("id ASC").Rows()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	filename := t.resource + "-" + time.Now().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == formatJSONL {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for rows.Next() {
+			var item T
+			if err := requestDB(r).ScanRows(rows, &item); err != nil {
+				abortExport(r, err)
+			}
+			if err := enc.Encode(item); err != nil {
+				abortExport(r, err)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			abortExport(r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.columns); err != nil {
+		abortExport(r, err)
+	}
+	for rows.Next() {
+		var item T
+		if err := requestDB(r).ScanRows(rows, &item); err != nil {
+			abortExport(r, err)
+		}
+		cells := t.values(&item)
+		for i := range cells {
+			cells[i] = csvSafe(cells[i])
+		}
+		if err := cw.Write(cells); err != nil {
+			abortExport(r, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(r, err)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		abortExport(r, err)
+	}
+}
+
+// abortExport ends a streamed export after the headers have gone out. The
+// panic makes net/http drop the connection, so the client sees a failed
+// download rather than a truncated file with a 200.
+func abortExport(r *http.Request, err error) {
+	logger.FromContext(r.Context()).Error("export aborted", "path", r.URL.Path, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+// markdownSource picks the text to import as content. JSON Lines exports of
+// Markdown items carry the rendered HTML in content and the Markdown in
+// content_source.
+func markdownSource(rec record) string {
+	if rec.str("content_format") == richtext.FormatMarkdown && rec.str("content_source") != "" {
+		return rec.text("content_source")
+	}
+	return rec.text("content")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func itoa(n int) string { return strconv.Itoa(n) }
+
+func uitoa(n uint) string { return strconv.FormatUint(uint64(n), 10) }
+
+var newsTransfer = transfer[models.News]{
+	resource: "news",
+	event:    "news.created",
+	columns:  []string{"id", "created_at", "title", "image", "detail", "content", "content_format", "category", "created_by"},
+	imports:  []string{"title", "image", "detail", "content", "content_format", "content_source", "category", "created_at"},
+	parse: func(rec record) (*models.News, []rowError) {
+		var errs []rowError
+		news := &models.News{
+			Title:         rec.require("title", &errs),
+			Image:         rec.str("image"),
+			Detail:        rec.text("detail"),
+			Content:       markdownSource(rec),
+			ContentFormat: rec.str("content_format"),
+			Category:      rec.str("category"),
+		}
+		if _, err := richtext.Render(news.ContentFormat, ""); err != nil {
+			errs = append(errs, rowError{Field: "content_format", Error: err.Error()})
+		}
+		if t := rec.time("created_at", &errs); t != nil {
+			news.CreatedAt = *t
+		}
+		return news, errs
+	},
+	author: func(news *models.News, id uint, name string) {
+		news.CreatedByID, news.CreatedBy = id, name
+		news.UpdatedByID, news.UpdatedBy = id, name
+	},
+	prepare: func(r *http.Request, news *models.News) error {
+		_, err := prepareNews(r, news)
+		return err
+	},
+	saved: func(r *http.Request, news *models.News) {
+		search.Sync("news", uint(news.ID))
+		trackImages(r, "news", uint(news.ID), i18n.Default(), append(richtext.Images(news.Content), news.Image))
+	},
+	id: func(news *models.News) uint { return uint(news.ID) },
+	values: func(n *models.News) []string {
+		content := n.Content
+		if n.ContentFormat == richtext.FormatMarkdown {
+			content = n.ContentSource
+		}
+		return []string{itoa(n.ID), formatTime(&n.CreatedAt), n.Title, n.Image, n.Detail, content, n.ContentFormat, n.Category, n.CreatedBy}
+	},
+}
+
+var highlightsTransfer = transfer[models.Highlights]{
+	resource: "highlights",
+	event:    "highlight.created",
+	columns:  []string{"id", "created_at", "title", "image", "content", "content_format", "position", "created_by"},
+	imports:  []string{"title", "image", "content", "content_format", "content_source", "position", "created_at"},
+	parse: func(rec record) (*models.Highlights, []rowError) {
+		var errs []rowError
+		h := &models.Highlights{
+			Title:         rec.require("title", &errs),
+			Image:         rec.str("image"),
+			Content:       markdownSource(rec),
+			ContentFormat: rec.str("content_format"),
+			Position:      rec.int("position", 0, &errs),
+		}
+		if _, err := richtext.Render(h.ContentFormat, ""); err != nil {
+			errs = append(errs, rowError{Field: "content_format", Error: err.Error()})
+		}
+		if t := rec.time("created_at", &errs); t != nil {
+			h.CreatedAt = *t
+		}
+		return h, errs
+	},
+	author: func(h *models.Highlights, id uint, name string) {
+		h.CreatedByID, h.CreatedBy = id, name
+		h.UpdatedByID, h.UpdatedBy = id, name
+	},
+	prepare: func(r *http.Request, h *models.Highlights) error {
+		_, err := prepareHighlights(r, h)
+		return err
+	},
+	saved: func(r *http.Request, h *models.Highlights) {
+		search.Sync("highlights", uint(h.ID))
+		trackImages(r, "highlights", uint(h.ID), i18n.Default(), append(richtext.Images(h.Content), h.Image))
+	},
+	id: func(h *models.Highlights) uint { return uint(h.ID) },
+	values: func(h *models.Highlights) []string {
+		content := h.Content
+		if h.ContentFormat == richtext.FormatMarkdown {
+			content = h.ContentSource
+		}
+		return []string{itoa(h.ID), formatTime(&h.CreatedAt), h.Title, h.Image, content, h.ContentFormat, itoa(h.Position), h.CreatedBy}
+	},
+}
+
+var sponsorsTransfer = transfer[models.Sponsors]{
+	resource: "sponsors",
+	event:    "sponsor.created",
+	columns:  []string{"id", "created_at", "name", "image_url", "redirect", "slot", "status", "priority", "weight", "position", "starts_at", "ends_at"},
+	imports:  []string{"name", "image_url", "redirect", "slot", "status", "priority", "weight", "position", "starts_at", "ends_at"},
+	parse: func(rec record) (*models.Sponsors, []rowError) {
+		var errs []rowError
+		s := &models.Sponsors{
+			Name:     rec.require("name", &errs),
+			ImageURL: rec.str("image_url"),
+			Redirect: rec.str("redirect"),
+			Slot:     rec.str("slot"),
+			Status:   rec.str("status"),
+			Priority: rec.int("priority", 0, &errs),
+			Weight:   rec.int("weight", 0, &errs),
+			Position: rec.int("position", 0, &errs),
+			StartsAt: rec.time("starts_at", &errs),
+			EndsAt:   rec.time("ends_at", &errs),
+		}
+		if err := s.Normalize(); err != nil {
+			errs = append(errs, rowError{Error: err.Error()})
+		}
+		return s, errs
+	},
+	id: func(s *models.Sponsors) uint { return s.ID },
+	values: func(s *models.Sponsors) []string {
+		return []string{uitoa(s.ID), formatTime(&s.CreatedAt), s.Name, s.ImageURL, s.Redirect, s.Slot, s.Status,
+			itoa(s.Priority), itoa(s.Weight), itoa(s.Position), formatTime(s.StartsAt), formatTime(s.EndsAt)}
+	},
+}
+
+var footersTransfer = transfer[models.Footers]{
+	resource: "footers",
+	event:    "footer.created",
+	columns:  []string{"id", "created_at", "name", "image_url", "redirect", "position"},
+	imports:  []string{"name", "image_url", "redirect", "position"},
+	parse: func(rec record) (*models.Footers, []rowError) {
+		var errs []rowError
+		f := &models.Footers{
+			Name:     rec.require("name", &errs),
+			ImageURL: rec.str("image_url"),
+			Redirect: rec.str("redirect"),
+			Position: rec.int("position", 0, &errs),
+		}
+		return f, errs
+	},
+	id: func(f *models.Footers) uint { return f.ID },
+	values: func(f *models.Footers) []string {
+		return []string{uitoa(f.ID), formatTime(&f.CreatedAt), f.Name, f.ImageURL, f.Redirect, itoa(f.Position)}
+	},
+}
+
+func ImportNews(w http.ResponseWriter, r *http.Request)       { newsTransfer.importRows(w, r) }
+func ExportNews(w http.ResponseWriter, r *http.Request)       { newsTransfer.exportRows(w, r) }
+func ImportHighlights(w http.ResponseWriter, r *http.Request) { highlightsTransfer.importRows(w, r) }
+func ExportHighlights(w http.ResponseWriter, r *http.Request) { highlightsTransfer.exportRows(w, r) }
+func ImportSponsors(w http.ResponseWriter, r *http.Request)   { sponsorsTransfer.importRows(w, r) }
+func ExportSponsors(w http.ResponseWriter, r *http.Request)   { sponsorsTransfer.exportRows(w, r) }
+func ImportFooters(w http.ResponseWriter, r *http.Request)    { footersTransfer.importRows(w, r) }
+func ExportFooters(w http.ResponseWriter, r *http.Request)    { footersTransfer.exportRows(w, r) }
@@ -0,0 +1,58 @@
+package controllers
+
+import "testing"
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello", "hello"},
+		{"empty", "", ""},
+		{"formula", "=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"plus", "+1", "'+1"},
+		{"minus", "-1", "'-1"},
+		{"at", "@cmd", "'@cmd"},
+		{"formula later", "a=b", "a=b"},
+		{"quote", "'tis", "'tis"},
+		{"lone quote", "'", "'"},
+		{"already looks escaped", "'=x", "''=x"},
+		{"quotes before a formula", "''-1", "'''-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvSafe(tt.in); got != tt.want {
+				t.Fatalf("csvSafe(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			// Whatever csvSafe writes, an import reads back unchanged
+			if got := csvUnescape(csvSafe(tt.in)); got != tt.in {
+				t.Fatalf("csvUnescape(csvSafe(%q)) = %q", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestCSVUnescape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello", "hello"},
+		{"escaped formula", "'=1+1", "=1+1"},
+		{"escaped minus", "'-5", "-5"},
+		{"quote kept", "'tis", "'tis"},
+		{"lone quote", "'", "'"},
+		{"double escaped", "''=x", "'=x"},
+		// Hand-written files may carry an unescaped formula; it is kept as is
+		{"unescaped formula", "=x", "=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvUnescape(tt.in); got != tt.want {
+				t.Fatalf("csvUnescape(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
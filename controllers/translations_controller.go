@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"wwb99/audit"
+	"wwb99/i18n"
+	"wwb99/logger"
+	"wwb99/models"
+	"wwb99/policy"
+	"wwb99/richtext"
+	"wwb99/search"
+
+	"gorm.io/gorm/clause"
+)
+
+// localize overlays the request's locale onto items and sets the
+// Content-Language header. On failure the default-locale text is served.
+func localize[T any, PT interface {
+	*T
+	models.Translatable
+}](w http.ResponseWriter, r *http.Request, items []T) {
+	locale := i18n.FromRequest(r)
+	if err := i18n.Translate[T, PT](locale, items); err != nil {
+		logger.FromContext(r.Context()).Error("failed to load translations", "locale", locale, "error", err)
+		locale = i18n.Default()
+	}
+	i18n.SetHeaders(w, locale)
+}
+
+// localizeOne is localize for a single item
+func localizeOne[T any, PT interface {
+	*T
+	models.Translatable
+}](w http.ResponseWriter, r *http.Request, item *T) {
+	items := []T{*item}
+	localize[T, PT](w, r, items)
+	*item = items[0]
+}
+
+// localizeExplicit is localize for endpoints the admin UI also uses: text is
+// only translated when ?lang= asks for it, so an editor whose browser
+// prefers another language still loads (and saves back) the default locale
+func localizeExplicit[T any, PT interface {
+	*T
+	models.Translatable
+}](w http.ResponseWriter, r *http.Request, items []T) {
+	if r.URL.Query().Get("lang") != "" {
+		localize[T, PT](w, r, items)
+	}
+}
+
+// localizeOneExplicit is localizeExplicit for a single item
+func localizeOneExplicit[T any, PT interface {
+	*T
+	models.Translatable
+}](w http.ResponseWriter, r *http.Request, item *T) {
+	if r.URL.Query().Get("lang") != "" {
+		localizeOne[T, PT](w, r, item)
+	}
+}
+
+// translationTarget loads the resource named by ?type= and ?id= and returns
+// its owner for the policy check
+func translationTarget(r *http.Request) (resourceType string, id uint, owner uint, ok bool) {
+	resourceType = r.URL.Query().Get("type")
+	n, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || n <= 0 {
+		return "", 0, 0, false
+	}
+	id = uint(n)
+
+	switch resourceType {
+	case "news":
+		var item models.News
+		if requestDB(r).Select("id", "created_by_id").First(&item, id).Error != nil {
+			return "", 0, 0, false
+		}
+		owner = item.CreatedByID
+	case "highlights":
+		var item models.Highlights
+		if requestDB(r).Select("id", "created_by_id").First(&item, id).Error != nil {
+			return "", 0, 0, false
+		}
+		owner = item.CreatedByID
+	case "footers":
+		if requestDB(r).Select("id").First(&models.Footers{}, id).Error != nil {
+			return "", 0, 0, false
+		}
+	case "sponsors":
+		if requestDB(r).Select("id").First(&models.Sponsors{}, id).Error != nil {
+			return "", 0, 0, false
+		}
+	default:
+		return "", 0, 0, false
+	}
+	return resourceType, id, owner, true
+}
+
+// itemContentFormat returns the content format of a news or highlights
+// item, which its translations are written in unless they say otherwise
+func itemContentFormat(r *http.Request, resourceType string, id uint) string {
+	var format string
+	switch resourceType {
+	case "news":
+		requestDB(r).Model(&models.News{}).Where("id = ?", id).Pluck("content_format", &format)
+	case "highlights":
+		requestDB(r).Model(&models.Highlights{}).Where("id = ?", id).Pluck("content_format", &format)
+	}
+	if format == "" {
+		return richtext.FormatHTML
+	}
+	return format
+}
+
+// GetTranslations lists every translation of ?type= (news, highlights,
+// footers, sponsors) and ?id=
+func GetTranslations(w http.ResponseWriter, r *http.Request) {
+	resourceType, id, _, ok := translationTarget(r)
+	if !ok {
+		http.Error(w, "Unknown type or id", http.StatusNotFound)
+		return
+	}
+
+	var translations []models.Translation
+	if err := requestDB(r).Where("resource_type = ? AND resource_id = ?", resourceType, id).
+		Order("locale").Find(&translations).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Success",
+		"default_locale": i18n.Default(),
+		"locales":        i18n.Locales,
+		"data":           translations,
+	})
+}
+
+// UpsertTranslation handles PUT /api/translations?type=&id=&locale= and
+// creates or replaces that locale's text. The default locale is edited on
+// the item itself.
+func UpsertTranslation(w http.ResponseWriter, r *http.Request) {
+	resourceType, id, owner, ok := translationTarget(r)
+	if !ok {
+		http.Error(w, "Unknown type or id", http.StatusNotFound)
+		return
+	}
+
+	locale := r.URL.Query().Get("locale")
+	if !i18n.Supported(locale) || locale == i18n.Default() {
+		http.Error(w, "Locale must be one of the non-default supported locales", http.StatusBadRequest)
+		return
+	}
+
+	if !allow(r, "update", policy.Resource{Type: resourceType, OwnerID: owner}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req models.Translation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var existing models.Translation
+	found := requestDB(r).Where("resource_type = ? AND resource_id = ? AND locale = ?", resourceType, id, locale).
+		First(&existing).Error == nil
+
+	translation := models.Translation{
+		ResourceType: resourceType,
+		ResourceID:   id,
+		Locale:       locale,
+		Title:        req.Title,
+		Detail:       req.Detail,
+		Content:      req.Content,
+		Name:         req.Name,
+	}
+	translation.UpdatedByID, translation.UpdatedBy = actor(r)
+
+	// Translated text goes through the same pipeline as the item itself, in
+	// the item's format unless content_format is given
+	var images []string
+	if translation.Content != "" {
+		format := req.ContentFormat
+		if format == "" {
+			format = itemContentFormat(r, resourceType, id)
+		}
+		doc, err := prepareContent(r, format, translation.Content)
+		if err != nil {
+			contentError(w, err)
+			return
+		}
+		translation.ContentFormat, translation.ContentSource = contentSource(format, translation.Content)
+		translation.Content, images = doc.HTML, doc.Images
+	}
+	if translation.Detail != "" {
+		translation.Detail = richtext.Sanitize(translation.Detail)
+	}
+
+	err := requestDB(r).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "resource_type"}, {Name: "resource_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "detail", "content", "content_format", "content_source", "name", "updated_by", "updated_by_id", "updated_at"}),
+	}).Create(&translation).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestDB(r).Where("resource_type = ? AND resource_id = ? AND locale = ?", resourceType, id, locale).First(&translation)
+
+	resourceID := strconv.FormatUint(uint64(id), 10) + ":" + locale
+	if found {
+		audit.Record(r, "update", resourceType+"_translation", resourceID, existing, translation)
+	} else {
+		audit.Record(r, "create", resourceType+"_translation", resourceID, nil, translation)
+	}
+	search.Sync(resourceType, id)
+	trackImages(r, resourceType, id, locale, images)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Translation saved successfully",
+		"data":    translation,
+	})
+}
+
+// DeleteTranslation handles DELETE /api/translations?type=&id=&locale=
+func DeleteTranslation(w http.ResponseWriter, r *http.Request) {
+	resourceType, id, owner, ok := translationTarget(r)
+	if !ok {
+		http.Error(w, "Unknown type or id", http.StatusNotFound)
+		return
+	}
+
+	if !allow(r, "update", policy.Resource{Type: resourceType, OwnerID: owner}) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	locale := r.URL.Query().Get("locale")
+	var existing models.Translation
+	if err := requestDB(r).Where("resource_type = ? AND resource_id = ? AND locale = ?", resourceType, id, locale).
+		First(&existing).Error; err != nil {
+		http.Error(w, "Translation not found", http.StatusNotFound)
+		return
+	}
+
+	if err := requestDB(r).Delete(&existing).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "delete", resourceType+"_translation", strconv.FormatUint(uint64(id), 10)+":"+locale, existing, nil)
+	search.Sync(resourceType, id)
+	trackImages(r, resourceType, id, locale, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Translation deleted successfully"})
+}
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"wwb99/audit"
+	"wwb99/logger"
+	"wwb99/models"
+	"wwb99/security"
+	"wwb99/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type twoFactorRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Password     string `json:"password"`
+}
+
+// userFromMFAToken resolves the user behind an intermediate login token
+func userFromMFAToken(r *http.Request, tokenStr string) (*models.User, jwt.MapClaims, error) {
+	claims, err := utils.ValidateMFAToken(tokenStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, nil, errors.New("invalid token claims")
+	}
+
+	var user models.User
+	if err := requestDB(r).Preload("Role.Permissions").First(&user, uint(userID)).Error; err != nil {
+		return nil, nil, err
+	}
+	return &user, claims, nil
+}
+
+// writeTOTPSetup generates and stores a fresh (not yet enabled) TOTP secret
+func writeTOTPSetup(w http.ResponseWriter, r *http.Request, user *models.User) {
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	if err := requestDB(r).Model(user).Updates(map[string]interface{}{
+		"totp_secret":         secret,
+		"totp_last_used_step": 0,
+	}).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Scan the QR code with your authenticator app, then confirm with a code",
+		"data": map[string]string{
+			"secret":           secret,
+			"provisioning_uri": security.TOTPProvisioningURI(secret, user.Username),
+		},
+	})
+}
+
+// LoginTwoFactorSetup lets a user whose role enforces 2FA enroll during login,
+// authenticated by the intermediate mfa_token
+func LoginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, _, err := userFromMFAToken(r, req.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	writeTOTPSetup(w, r, user)
+}
+
+// LoginTwoFactor completes a login that returned mfa_required. When the user
+// is still enrolling, a valid code also enables 2FA and the response carries
+// the one-time recovery codes.
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, claims, err := userFromMFAToken(r, req.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	attempt, err := security.ReserveLogin(ip, user.Username)
+	if err != nil {
+		var blocked *security.LoginBlockedError
+		if errors.As(err, &blocked) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+			http.Error(w, blocked.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := security.VerifySecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+		security.LogLoginAttempt(user.Username, ip, r.UserAgent(), false, "invalid_2fa_code")
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	// The token completes one login only; a replay must start over with
+	// the password
+	exp, _ := claims.GetExpirationTime()
+	if err := security.ConsumeMFAToken(user.ID, utils.TokenID(claims), exp.Time); err != nil {
+		security.LogLoginAttempt(user.Username, ip, r.UserAgent(), false, "mfa_token_reused")
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+	if err := attempt.Release(); err != nil {
+		logger.FromContext(r.Context()).Error("failed to release login attempt", "error", err)
+	}
+
+	var recoveryCodes []string
+	if !user.TOTPEnabled {
+		recoveryCodes, err = security.EnableTwoFactor(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	completeLogin(w, r, user, recoveryCodes)
+}
+
+// currentUser loads the authenticated user set by AuthMiddleware
+func currentUser(r *http.Request) (*models.User, error) {
+	userID, ok := r.Context().Value("user_id").(uint)
+	if !ok {
+		return nil, errors.New("unauthenticated")
+	}
+
+	var user models.User
+	if err := requestDB(r).Preload("Role").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetupTwoFactor starts TOTP enrollment for the logged-in user
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	writeTOTPSetup(w, r, user)
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Missing code", http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	if err := security.VerifySecondFactor(user, req.Code, ""); err != nil {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := security.EnableTwoFactor(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "enable_2fa", "user", user.ID, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Two-factor authentication enabled",
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactor turns 2FA off; requires the password and a current code
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if user.Role.Require2FA {
+		http.Error(w, "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if err := security.VerifySecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := security.DisableTwoFactor(user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "disable_2fa", "user", user.ID, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes; requires a current code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Missing code", http.StatusBadRequest)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	if err := security.VerifySecondFactor(user, req.Code, ""); err != nil {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := security.ReplaceRecoveryCodes(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "regenerate_recovery_codes", "user", user.ID, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Recovery codes regenerated",
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+	})
+}
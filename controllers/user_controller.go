@@ -3,15 +3,61 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
-	"wwb99/config"
+	"strconv"
+	"wwb99/middleware"
 	"wwb99/models"
+	"wwb99/security"
 )
 
 func Profile(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(uint)
 
 	var user models.User
-	config.DB.Preload("Role.Permissions").First(&user, userID)
+	requestDB(r).Preload("Role.Permissions").First(&user, userID)
 
 	json.NewEncoder(w).Encode(user)
 }
+
+// GetUserPermissions returns a user's effective permissions (inherited and
+// wildcard grants expanded) with the role each one comes from. Defaults to
+// the current user when ?id= is omitted.
+func GetUserPermissions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(uint)
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+			return
+		}
+		// Other users' permissions are for user admins only
+		if uint(id) != userID && !middleware.HasPermission(r, "view_users") {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		userID = uint(id)
+	}
+
+	var user models.User
+	if err := requestDB(r).Preload("Role").First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	grants, err := security.EffectivePermissions(user.RoleID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Success",
+		"data": map[string]interface{}{
+			"user_id":     user.ID,
+			"username":    user.Username,
+			"role":        user.Role.Name,
+			"role_id":     user.RoleID,
+			"permissions": grants,
+		},
+	})
+}
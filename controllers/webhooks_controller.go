@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"wwb99/audit"
+	"wwb99/models"
+	"wwb99/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// webhookRequest is the body of create and update. Omitted fields are left
+// unchanged on update.
+type webhookRequest struct {
+	Name         *string  `json:"name"`
+	URL          *string  `json:"url"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+// apply validates req and copies it onto h
+func (req *webhookRequest) apply(h *models.Webhook) string {
+	if req.Name != nil {
+		h.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		h.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Events != nil {
+		events := make([]string, 0, len(req.Events))
+		for _, e := range req.Events {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			if !webhooks.ValidEvent(e) {
+				return "Unknown event: " + e
+			}
+			events = append(events, e)
+		}
+		h.Events = strings.Join(events, ",")
+	}
+	if req.Active != nil {
+		h.Active = *req.Active
+	}
+
+	if h.Name == "" {
+		return "Name is required"
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "URL must be an absolute http or https URL"
+	}
+	if h.Events == "" {
+		return "At least one event is required"
+	}
+	return ""
+}
+
+// queryID parses ?id=. Passing the raw string to First would let GORM treat
+// it as an SQL condition, and an empty one would match the first row.
+func queryID(r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetWebhooks lists registered webhooks
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	var hooks []models.Webhook
+	if err := requestDB(r).Order("id").Find(&hooks).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Success", "data": hooks})
+}
+
+// GetWebhookEvents lists the events webhooks can subscribe to
+func GetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Success", "data": webhooks.Events})
+}
+
+// CreateWebhook registers an endpoint. The signing secret is returned in
+// this response only.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hook := models.Webhook{Active: true}
+	if msg := req.apply(&hook); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	hook.Secret = secret
+	hook.CreatedByID, hook.CreatedBy = actor(r)
+
+	if err := requestDB(r).Create(&hook).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "create", "webhook", hook.ID, nil, hook)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Webhook created successfully",
+		"data":    hook,
+		"secret":  secret,
+	})
+}
+
+// UpdateWebhook edits a webhook (PUT /api/webhooks?id=). rotate_secret
+// replaces the signing secret and returns the new one.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryID(r)
+	if !ok {
+		http.Error(w, "Missing or invalid id", http.StatusBadRequest)
+		return
+	}
+	var existing models.Webhook
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hook := existing
+	if msg := req.apply(&hook); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{"message": "Webhook updated successfully"}
+	if req.RotateSecret {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+		hook.Secret = secret
+		response["secret"] = secret
+	}
+
+	if err := requestDB(r).Select("name", "url", "events", "active", "secret").Save(&hook).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "update", "webhook", hook.ID, existing, hook)
+
+	response["data"] = hook
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteWebhook removes a webhook with its deliveries and their logs
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryID(r)
+	if !ok {
+		http.Error(w, "Missing or invalid id", http.StatusBadRequest)
+		return
+	}
+	var existing models.Webhook
+	if err := requestDB(r).First(&existing, id).Error; err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	deliveries := requestDB(r).Model(&models.WebhookDelivery{}).Select("id").Where("webhook_id = ?", existing.ID)
+	if err := requestDB(r).Where("delivery_id IN (?)", deliveries).Delete(&models.WebhookAttempt{}).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := requestDB(r).Where("webhook_id = ?", existing.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := requestDB(r).Delete(&existing).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "delete", "webhook", existing.ID, existing, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// TestWebhook queues a webhook.ping delivery (POST /api/webhooks/test?id=)
+func TestWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryID(r)
+	if !ok {
+		http.Error(w, "Missing or invalid id", http.StatusBadRequest)
+		return
+	}
+	var hook models.Webhook
+	if err := requestDB(r).First(&hook, id).Error; err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	delivery, err := webhooks.Ping(&hook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Ping queued", "data": delivery})
+}
+
+var deliveryIncludes = map[string]string{"attempts": "AttemptLog"}
+
+// GetWebhookDeliveries lists the delivery log, newest first. Filters:
+// webhook_id, status (pending, succeeded, failed), event. include=attempts
+// adds each request made.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	list, err := parseListing(r, listOptions{
+		defaultLimit: 20,
+		sorts: map[string]bool{
+			"id":              true,
+			"created_at":      true,
+			"next_attempt_at": true,
+		},
+		defaultSort: "id",
+	})
+	if err != nil {
+		listError(w, err)
+		return
+	}
+	includes, err := parseIncludes(r, deliveryIncludes)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	db := requestDB(r).Model(&models.WebhookDelivery{})
+	if v := q.Get("webhook_id"); v != "" {
+		db = db.Where("webhook_id = ?", v)
+	}
+	if v := q.Get("status"); v != "" {
+		db = db.Where("status = ?", v)
+	}
+	if v := q.Get("event"); v != "" {
+		db = db.Where("event = ?", v)
+	}
+
+	var total int64
+	db.Count(&total)
+
+	db = list.preload(db, includes)
+	deliveries, info, err := findPage[models.WebhookDelivery](list, db)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list.response(deliveries, total, info))
+}
+
+// GetWebhookDeliveryByID returns one delivery with every attempt
+func GetWebhookDeliveryByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryID(r)
+	if !ok {
+		http.Error(w, "Missing or invalid id", http.StatusBadRequest)
+		return
+	}
+	var delivery models.WebhookDelivery
+	err := requestDB(r).Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("attempt") }).
+		First(&delivery, id).Error
+	if err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Success", "data": delivery})
+}
+
+// RedeliverWebhook queues the payload of a past delivery again
+// (POST /api/webhooks/deliveries/redeliver?id=)
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryID(r)
+	if !ok {
+		http.Error(w, "Missing or invalid id", http.StatusBadRequest)
+		return
+	}
+	var original models.WebhookDelivery
+	if err := requestDB(r).First(&original, id).Error; err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if original.Status == models.DeliveryPending {
+		http.Error(w, "Delivery is still pending", http.StatusConflict)
+		return
+	}
+	var hook models.Webhook
+	if err := requestDB(r).First(&hook, original.WebhookID).Error; err != nil {
+		http.Error(w, "Webhook no longer exists", http.StatusGone)
+		return
+	}
+
+	delivery, err := webhooks.Redeliver(&original)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, "redeliver", "webhook_delivery", original.ID, nil, delivery)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Redelivery queued", "data": delivery})
+}
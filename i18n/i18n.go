@@ -0,0 +1,165 @@
+// Package i18n selects the response language and overlays stored
+// translations onto content models.
+package i18n
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wwb99/config"
+	"wwb99/models"
+)
+
+// Supported content locales
+var Locales = []string{"km", "en", "zh"}
+
+// Default is the locale content items are stored in (CONTENT_DEFAULT_LOCALE,
+// default km). It is served when no translation exists.
+func Default() string {
+	if l := strings.ToLower(os.Getenv("CONTENT_DEFAULT_LOCALE")); Supported(l) {
+		return l
+	}
+	return "km"
+}
+
+// Supported reports whether locale is one of Locales
+func Supported(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// match maps a language tag such as "zh-Hant-TW" or "en_US" to a supported
+// locale
+func match(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if Supported(tag) {
+		return tag
+	}
+	return ""
+}
+
+// FromRequest picks the locale from ?lang=, then Accept-Language (by
+// q-value), then the default
+func FromRequest(r *http.Request) string {
+	if l := match(r.URL.Query().Get("lang")); l != "" {
+		return l
+	}
+
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if l := match(tag); l != "" && q > 0 {
+			candidates = append(candidates, candidate{l, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) > 0 {
+		return candidates[0].locale
+	}
+	return Default()
+}
+
+// SetHeaders marks the response language; responses vary by Accept-Language
+func SetHeaders(w http.ResponseWriter, locale string) {
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+}
+
+// Translate overlays locale's translations onto items in place. Fields
+// without a translation keep the default-locale value.
+func Translate[T any, PT interface {
+	*T
+	models.Translatable
+}](locale string, items []T) error {
+	if locale == Default() || len(items) == 0 {
+		return nil
+	}
+
+	resourceType, _ := PT(&items[0]).TranslationKey()
+	ids := make([]uint, 0, len(items))
+	for i := range items {
+		_, id := PT(&items[i]).TranslationKey()
+		ids = append(ids, id)
+	}
+
+	var translations []models.Translation
+	err := config.DB.Where("resource_type = ? AND locale = ? AND resource_id IN ?", resourceType, locale, ids).
+		Find(&translations).Error
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint]*models.Translation, len(translations))
+	for i := range translations {
+		byID[translations[i].ResourceID] = &translations[i]
+	}
+	for i := range items {
+		_, id := PT(&items[i]).TranslationKey()
+		if t, ok := byID[id]; ok {
+			PT(&items[i]).ApplyTranslation(t)
+		}
+	}
+	return nil
+}
+
+// TranslateOne is Translate for a single item
+func TranslateOne[T any, PT interface {
+	*T
+	models.Translatable
+}](locale string, item *T) error {
+	items := []T{*item}
+	if err := Translate[T, PT](locale, items); err != nil {
+		return err
+	}
+	*item = items[0]
+	return nil
+}
+
+// AvailableLocales returns, per resource ID, the locales it can be read in:
+// the default plus every translated locale
+func AvailableLocales(resourceType string, ids []uint) (map[uint][]string, error) {
+	var rows []models.Translation
+	err := config.DB.Select("resource_id", "locale").
+		Where("resource_type = ? AND resource_id IN ?", resourceType, ids).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	available := make(map[uint][]string, len(ids))
+	for _, id := range ids {
+		available[id] = []string{Default()}
+	}
+	for _, row := range rows {
+		if row.Locale != Default() {
+			available[row.ResourceID] = append(available[row.ResourceID], row.Locale)
+		}
+	}
+	return available, nil
+}
+
+// DeleteTranslations removes every translation of a resource
+func DeleteTranslations(resourceType string, id uint) error {
+	return config.DB.Where("resource_type = ? AND resource_id = ?", resourceType, id).
+		Delete(&models.Translation{}).Error
+}
@@ -0,0 +1,168 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"wwb99/logger"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultMailer Mailer
+	defaultErr    error
+)
+
+// Init selects the mailer named by MAILER (log, file or smtp). MAILER may
+// only be left unset in development (no RAILWAY_ENVIRONMENT), where it
+// falls back to the log mailer
+func Init() error {
+	defaultOnce.Do(func() {
+		defaultMailer, defaultErr = fromEnv()
+	})
+	return defaultErr
+}
+
+func fromEnv() (Mailer, error) {
+	switch name := strings.ToLower(os.Getenv("MAILER")); name {
+	case "smtp":
+		m := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if m.Host == "" {
+			return nil, fmt.Errorf("MAILER=smtp requires SMTP_HOST")
+		}
+		return m, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir, From: os.Getenv("MAIL_FROM")}, nil
+	case "log":
+		return LogMailer{}, nil
+	case "":
+		if os.Getenv("RAILWAY_ENVIRONMENT") != "" {
+			return nil, fmt.Errorf("MAILER must be set to log, file or smtp")
+		}
+		slog.Warn("MAILER not set, emails are only logged (development)")
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", name)
+	}
+}
+
+// Default returns the selected mailer, or nil if Init failed
+func Default() Mailer {
+	Init()
+	return defaultMailer
+}
+
+// Send delivers msg through the default mailer
+func Send(ctx context.Context, msg Message) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	return defaultMailer.Send(ctx, msg)
+}
+
+// LogMailer logs that a message was sent instead of sending it (local
+// use). The body is never logged since it carries reset and invitation
+// tokens
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	logger.FromContext(ctx).Info("email",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.Int("body_bytes", len(msg.Body)),
+	)
+	return nil
+}
+
+// FileMailer writes each message as an .eml file into Dir (local use)
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitizeFilename(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage(m.From, msg), 0o644)
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// SMTPMailer sends through an SMTP relay using PLAIN auth
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	port := m.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+port, auth, m.From, []string{msg.To}, buildMessage(m.From, msg))
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+// headerValue strips CR/LF so user supplied values can't inject headers
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -1,42 +1,103 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"wwb99/analytics"
 	"wwb99/config"
+	"wwb99/logger"
+	"wwb99/mailer"
 	"wwb99/middleware"
 	"wwb99/models"
 	"wwb99/routes"
+	"wwb99/search"
+	"wwb99/utils"
+	"wwb99/webhooks"
 )
 
 func main() {
+	config.LoadEnv()
+	logger.Init()
+
 	// Connect and migrate DB
 	config.Connect()
 	err := config.DB.AutoMigrate(
 		&models.User{},
 		&models.Role{},
 		&models.Permission{},
+		&models.News{},
+		&models.Highlights{},
+		&models.Footers{},
+		&models.Sponsors{},
+		&models.SponsorClick{},
+		&models.SponsorDailyStat{},
+		&models.LoginThrottle{},
+		&models.LoginAttempt{},
+		&models.RecoveryCode{},
+		&models.UsedMFAToken{},
+		&models.PasswordResetToken{},
+		&models.Invitation{},
+		&models.APIKey{},
+		&models.SigningKey{},
+		&models.AuditLog{},
+		&models.Session{},
+		&models.Translation{},
+		&models.Media{},
+		&models.MediaUsage{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
 	)
 	if err != nil {
-		log.Fatalf("❌ Failed to migrate database: %v", err)
+		slog.Error("Failed to migrate database", "error", err)
+		os.Exit(1)
+	}
+
+	// Load JWT signing keys and start scheduled rotation
+	if err := utils.InitKeyRing(); err != nil {
+		slog.Error("Failed to initialise JWT signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	// Pick how outgoing email is delivered
+	if err := mailer.Init(); err != nil {
+		slog.Error("Failed to configure mailer", "error", err)
+		os.Exit(1)
+	}
+
+	// Roll sponsor clicks up into daily stats
+	analytics.StartRollups(time.Hour)
+
+	// Send queued webhook deliveries and retry failed ones
+	webhooks.StartWorker(15 * time.Second)
+
+	// Build the search index from the database
+	if err := search.Rebuild(); err != nil {
+		slog.Error("Failed to build search index", "error", err)
 	}
 
-	// 🔁 Load your app router
+	// Load your app router
 	router := routes.RegisterRoutes()
 
-	// ✅ Wrap with prerender first, then CORS (order matters)
+	// Wrap with prerender first, then CSRF, CORS, security headers and
+	// request logging (order matters)
 	withPrerender := middleware.PrerenderMiddleware(router)
-	withCORS := middleware.CORSMiddleware(withPrerender)
+	withCSRF := middleware.CSRFMiddleware(withPrerender)
+	withCORS := middleware.CORSMiddleware(withCSRF)
+	withHeaders := middleware.SecurityHeaders(withCORS)
+	withLogging := middleware.RequestLogger(withHeaders)
 
 	// Start server
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	log.Printf("🚀 Server running at http://localhost:%s", port)
-	if err := http.ListenAndServe(":"+port, withCORS); err != nil {
-		log.Fatalf("❌ Failed to start server: %v", err)
+	slog.Info("Server running", "addr", "http://localhost:"+port)
+	if err := http.ListenAndServe(":"+port, withLogging); err != nil {
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
 	}
 }
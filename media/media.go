@@ -0,0 +1,205 @@
+// Package media maintains the media library: images extracted from content
+// are stored on disk, and every image a content item references is recorded
+// with its usages.
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTooLarge    = errors.New("embedded image exceeds the maximum size")
+	ErrNotAnImage  = errors.New("embedded data is not a supported image")
+	ErrBadEncoding = errors.New("embedded image is not valid base64")
+	ErrInUse       = errors.New("media is still used by content")
+)
+
+// Stored image types and their file extensions
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Dir is where extracted images are written (MEDIA_DIR, default ./uploads)
+func Dir() string {
+	if d := os.Getenv("MEDIA_DIR"); d != "" {
+		return d
+	}
+	return "uploads"
+}
+
+// BaseURL is the public prefix stored files are served under (MEDIA_BASE_URL,
+// default /media)
+func BaseURL() string {
+	if u := os.Getenv("MEDIA_BASE_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "/media"
+}
+
+// MaxBytes limits one embedded image (MEDIA_MAX_BYTES, default 5 MiB)
+func MaxBytes() int {
+	if n, err := strconv.Atoi(os.Getenv("MEDIA_MAX_BYTES")); err == nil && n > 0 {
+		return n
+	}
+	return 5 << 20
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store writes image data to the library, returning the existing entry when
+// the same bytes were stored before
+func Store(data []byte, byID uint, by string) (*models.Media, error) {
+	if len(data) > MaxBytes() {
+		return nil, ErrTooLarge
+	}
+	// Trust the bytes, not the declared type
+	mimeType := http.DetectContentType(data)
+	ext, ok := extensions[mimeType]
+	if !ok {
+		return nil, ErrNotAnImage
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	var existing models.Media
+	if err := config.DB.Where("sha256 = ? AND source = ?", digest, models.MediaEmbedded).First(&existing).Error; err == nil {
+		return &existing, nil
+	}
+
+	if err := os.MkdirAll(Dir(), 0o755); err != nil {
+		return nil, err
+	}
+	filename := digest + ext
+	if err := os.WriteFile(filepath.Join(Dir(), filename), data, 0o644); err != nil {
+		return nil, err
+	}
+
+	url := BaseURL() + "/" + filename
+	m := models.Media{
+		URL:         url,
+		URLHash:     hashString(url),
+		Source:      models.MediaEmbedded,
+		Filename:    filename,
+		MimeType:    mimeType,
+		Size:        int64(len(data)),
+		SHA256:      digest,
+		CreatedBy:   by,
+		CreatedByID: byID,
+	}
+	err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&m).Error
+	if err != nil {
+		return nil, err
+	}
+	if m.ID == 0 {
+		// Another request stored the same image concurrently
+		err = config.DB.Where("url_hash = ?", m.URLHash).First(&m).Error
+	}
+	return &m, err
+}
+
+var dataImage = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*)(["'])data:image/[a-z0-9.+-]+;base64,([a-z0-9+/=\s]+)(["'])`)
+
+// ExtractEmbedded stores every base64 data: URI image in an HTML fragment
+// and points its <img> at the stored file. It must run before sanitizing,
+// which drops data: URIs.
+func ExtractEmbedded(fragment string, byID uint, by string) (string, error) {
+	var firstErr error
+	out := dataImage.ReplaceAllStringFunc(fragment, func(tag string) string {
+		m := dataImage.FindStringSubmatch(tag)
+		if m[2] != m[4] || firstErr != nil {
+			return tag
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(m[3]), ""))
+		if err != nil {
+			firstErr = ErrBadEncoding
+			return tag
+		}
+		stored, err := Store(data, byID, by)
+		if err != nil {
+			firstErr = err
+			return tag
+		}
+		return m[1] + m[2] + stored.URL + m[2]
+	})
+	return out, firstErr
+}
+
+// Track records the images one locale of a content item references,
+// replacing what was recorded before. Unknown URLs are added to the library
+// as external images.
+func Track(resourceType string, resourceID uint, locale string, urls []string, byID uint, by string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("resource_type = ? AND resource_id = ? AND locale = ?", resourceType, resourceID, locale).
+			Delete(&models.MediaUsage{}).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool)
+		for _, url := range urls {
+			url = strings.TrimSpace(url)
+			if url == "" || seen[url] || len(url) > 1024 || strings.HasPrefix(url, "data:") {
+				continue
+			}
+			seen[url] = true
+
+			m := models.Media{URL: url, URLHash: hashString(url), Source: models.MediaExternal, CreatedBy: by, CreatedByID: byID}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&m).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("url_hash = ?", m.URLHash).First(&m).Error; err != nil {
+				return err
+			}
+			usage := models.MediaUsage{MediaID: m.ID, ResourceType: resourceType, ResourceID: resourceID, Locale: locale}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Release forgets every usage of a deleted content item
+func Release(resourceType string, resourceID uint) error {
+	return config.DB.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Delete(&models.MediaUsage{}).Error
+}
+
+// Delete removes an unused media item and its stored file
+func Delete(m *models.Media) error {
+	var usages int64
+	config.DB.Model(&models.MediaUsage{}).Where("media_id = ?", m.ID).Count(&usages)
+	if usages > 0 {
+		return ErrInUse
+	}
+	if err := config.DB.Delete(m).Error; err != nil {
+		return err
+	}
+	if m.Filename != "" {
+		if err := os.Remove(filepath.Join(Dir(), m.Filename)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HTTP requests, labelled by the mux route template (e.g. /api/news/update/{id})
+	HTTPRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wwb99_http_requests_total",
+		Help: "Total number of HTTP requests handled.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wwb99_http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wwb99_http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served.",
+	}, []string{"route"})
+
+	// Database queries issued through GORM
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wwb99_db_query_duration_seconds",
+		Help:    "GORM query latency in seconds.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table", "status"})
+
+	// Authentication
+	LoginAttemptsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wwb99_login_attempts_total",
+		Help: "Login attempts by result (success, failure).",
+	}, []string{"result"})
+
+	// Rate limiting
+	RateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wwb99_rate_limited_requests_total",
+		Help: "Requests rejected with 429 by rate limit policy.",
+	}, []string{"policy"})
+
+	// Prerender.io proxy
+	PrerenderRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wwb99_prerender_requests_total",
+		Help: "Crawler requests proxied to Prerender.io by outcome.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		HTTPRequestsInFlight,
+		DBQueryDuration,
+		LoginAttemptsTotal,
+		RateLimitedTotal,
+		PrerenderRequestsTotal,
+	)
+}
+
+// Handler serves the /metrics endpoint
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
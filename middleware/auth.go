@@ -3,36 +3,65 @@ package middleware
 import (
 	"context"
 	"net/http"
-	"os"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"wwb99/logger"
+	"wwb99/security"
+	"wwb99/utils"
 )
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Machine clients authenticate with an API key instead of a JWT
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			apiKey, err := security.AuthenticateAPIKey(key, utils.ClientIP(r))
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), "api_key", apiKey)
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("api_key", apiKey.Prefix))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		tokenString := strings.Replace(r.Header.Get("Authorization"), "Bearer ", "", 1)
 		if tokenString == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := utils.ValidateAccessToken(tokenString)
+		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			ctx := context.WithValue(r.Context(), "user_id", uint(claims["user_id"].(float64)))
-			next.ServeHTTP(w, r.WithContext(ctx))
+		// Tokens stop working as soon as their session is revoked
+		userID := uint(claims["user_id"].(float64))
+		sessionID := utils.SessionID(claims)
+		if _, err := security.ValidateSession(sessionID, userID, utils.ClientIP(r)); err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if info := logger.GetRequestInfo(r.Context()); info != nil {
+			info.UserID = userID
+		}
+		ctx := context.WithValue(r.Context(), "user_id", userID)
+		ctx = context.WithValue(ctx, "session_id", sessionID)
+		if roleID, ok := claims["role_id"].(float64); ok {
+			ctx = context.WithValue(ctx, "role_id", uint(roleID))
 
+			// Tell the client its token predates a permission change so it can
+			// refresh; authorization itself always uses the current permissions
+			if version, ok := claims["perm_version"].(float64); ok {
+				if _, current, err := security.RolePermissions(uint(roleID)); err == nil && current != uint(version) {
+					w.Header().Set("X-Permissions-Stale", "true")
+				}
+			}
+		}
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("user_id", userID))
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
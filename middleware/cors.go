@@ -2,23 +2,209 @@ package middleware
 
 import (
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"wwb99/security"
 )
 
-func CORSMiddleware(next http.Handler) http.Handler {
+// CORSPolicy describes which cross-origin callers may use a set of routes.
+// AllowedOrigins entries are exact origins ("https://wwb99.2m-sy.com"),
+// wildcard subdomains ("https://*.2m-sy.com", which does not match the apex)
+// or "*" for any origin.
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int // seconds browsers may cache a preflight
+}
+
+func envList(name, def string) []string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		v = def
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// CORSPolicyFromEnv reads the default policy:
+//
+//	CORS_ALLOWED_ORIGINS   comma separated origins/patterns (default https://wwb99.2m-sy.com)
+//	CORS_ALLOWED_METHODS   default GET, POST, PUT, DELETE, OPTIONS
+//	CORS_ALLOWED_HEADERS   default Content-Type, Authorization, X-API-Key, X-CSRF-Token, X-Request-ID
+//	CORS_EXPOSED_HEADERS   default X-Request-ID, X-Permissions-Stale, the RateLimit-* headers and Retry-After
+//	CORS_ALLOW_CREDENTIALS default true
+//	CORS_MAX_AGE_SECONDS   default 600
+func CORSPolicyFromEnv() CORSPolicy {
+	policy := CORSPolicy{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS", "https://wwb99.2m-sy.com"),
+		AllowedMethods: envList("CORS_ALLOWED_METHODS", "GET, POST, PUT, DELETE, OPTIONS"),
+		AllowedHeaders: envList("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-API-Key, "+security.CSRFHeader+", "+RequestIDHeader),
+		ExposedHeaders: envList("CORS_EXPOSED_HEADERS", RequestIDHeader+", X-Permissions-Stale, "+
+			"RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After"),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") != "false",
+		MaxAge:           600,
+	}
+	if s, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE_SECONDS")); err == nil && s >= 0 {
+		policy.MaxAge = s
+	}
+	return policy
+}
+
+// PublicCORSPolicy lets any origin read a resource without credentials
+func PublicCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type"},
+		ExposedHeaders: []string{RequestIDHeader},
+		MaxAge:         86400,
+	}
+}
+
+// originMatches reports whether origin satisfies pattern
+func originMatches(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	pattern = strings.TrimRight(strings.ToLower(pattern), "/")
+	if !strings.Contains(pattern, "*") {
+		return pattern == origin
+	}
+
+	p, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if p.Scheme != o.Scheme || p.Port() != o.Port() {
+		return false
+	}
+
+	suffix, ok := strings.CutPrefix(p.Hostname(), "*.")
+	if !ok {
+		return false
+	}
+	host := o.Hostname()
+	return strings.HasSuffix(host, "."+suffix) && len(host) > len(suffix)+1
+}
+
+func (p *CORSPolicy) allowOrigin(origin string) bool {
+	for _, pattern := range p.AllowedOrigins {
+		if originMatches(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) anyOrigin() bool {
+	for _, pattern := range p.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type corsRoute struct {
+	prefix string
+	policy CORSPolicy
+}
+
+// CORS applies a default policy, overridden for requests whose path starts
+// with a registered prefix (the longest prefix wins)
+type CORS struct {
+	policy CORSPolicy
+	routes []corsRoute
+}
+
+func NewCORS(policy CORSPolicy) *CORS {
+	return &CORS{policy: policy}
+}
+
+// Route overrides the policy for paths starting with prefix
+func (c *CORS) Route(prefix string, policy CORSPolicy) *CORS {
+	c.routes = append(c.routes, corsRoute{prefix: prefix, policy: policy})
+	return c
+}
+
+func (c *CORS) policyFor(path string) *CORSPolicy {
+	policy, longest := &c.policy, -1
+	for i, route := range c.routes {
+		if strings.HasPrefix(path, route.prefix) && len(route.prefix) > longest {
+			policy, longest = &c.routes[i].policy, len(route.prefix)
+		}
+	}
+	return policy
+}
+
+func (c *CORS) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow local frontend
-		w.Header().Set("Access-Control-Allow-Origin", "https://wwb99.2m-sy.com")
-		// w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-
-		// For preflight requests (OPTIONS)
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		policy := c.policyFor(r.URL.Path)
+		h := w.Header()
+		preflight := r.Method == http.MethodOptions
+
+		// The response differs per Origin, so shared caches must key on it
+		h.Add("Vary", "Origin")
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := strings.ToLower(r.Header.Get("Origin"))
+		if origin != "" && policy.allowOrigin(origin) {
+			// Browsers refuse credentials with "*", and echoing arbitrary
+			// origins with credentials would expose users' sessions, so an
+			// any-origin policy never allows credentials
+			if policy.anyOrigin() {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+				if policy.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+				h.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+				if policy.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+				}
+			} else if len(policy.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+		}
+
+		// For preflight requests (OPTIONS). Disallowed origins get no CORS
+		// headers, so the browser blocks the actual request.
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// CORSMiddleware applies the environment-configured policy, with public
+// discovery endpoints readable from any origin
+func CORSMiddleware(next http.Handler) http.Handler {
+	return NewCORS(CORSPolicyFromEnv()).
+		Route("/.well-known/", PublicCORSPolicy()).
+		Handler(next)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"wwb99/logger"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts client supplied IDs only if they are short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogger assigns (or propagates) X-Request-ID, stores a request-scoped
+// logger in the context and writes one access log line per request.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &logger.RequestInfo{ID: id}
+		l := slog.Default().With(slog.String("request_id", id))
+		ctx := logger.WithRequestInfo(r.Context(), info)
+		ctx = logger.WithContext(ctx, l)
+
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		route := info.Route
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if info.UserID != 0 {
+			attrs = append(attrs, slog.Uint64("user_id", uint64(info.UserID)))
+		}
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		l.Log(r.Context(), level, "request", attrs...)
+	})
+}
+
+// TagRoute records the matched mux route template for the access log. It must
+// be registered with router.Use.
+func TagRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := logger.GetRequestInfo(r.Context()); info != nil {
+			info.Route = routeTemplate(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wwb99/metrics"
+	"wwb99/security"
+	"wwb99/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// routeTemplate returns the matched mux path template so that metrics are
+// labelled by route (/api/news/update/{id}) rather than by raw path
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+// MetricsMiddleware records request count, latency and in-flight requests.
+// It must be registered with router.Use so the route is already matched.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		inFlight := metrics.HTTPRequestsInFlight.WithLabelValues(route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+// MetricsAuth restricts the /metrics endpoint. Scrapers authenticate with
+// "Authorization: Bearer $METRICS_TOKEN" or connect from an address in
+// METRICS_ALLOWED_IPS (IPs and CIDRs). With neither set only loopback
+// clients are served.
+func MetricsAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("METRICS_TOKEN")
+		allowed := os.Getenv("METRICS_ALLOWED_IPS")
+		ip := utils.ClientIP(r)
+
+		ok := false
+		if token != "" {
+			bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			ok = found && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+		}
+		if !ok && allowed != "" {
+			ok = security.IPAllowed(allowed, ip)
+		}
+		if token == "" && allowed == "" {
+			addr := net.ParseIP(ip)
+			ok = addr != nil && addr.IsLoopback()
+		}
+
+		if !ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"wwb99/models"
+	"wwb99/security"
+)
+
+// HasPermission reports whether the authenticated caller (user or API key)
+// holds the named permission
+func HasPermission(r *http.Request, name string) bool {
+	if apiKey, ok := r.Context().Value("api_key").(*models.APIKey); ok {
+		return apiKey.HasPermission(name)
+	}
+
+	roleID, ok := r.Context().Value("role_id").(uint)
+	if !ok {
+		return false
+	}
+	return security.RoleHasPermission(roleID, name)
+}
+
+// RequirePermission rejects callers lacking the named permission. It must run
+// after AuthMiddleware.
+func RequirePermission(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r, name) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUser rejects API key callers; used for account and credential
+// management endpoints that only a human user may reach
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("user_id").(uint); !ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
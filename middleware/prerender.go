@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"io"
-	"log"
 	"net/http"
 	"strings"
+
+	"wwb99/logger"
+	"wwb99/metrics"
 )
 
 var crawlerUserAgents = []string{
@@ -13,6 +15,11 @@ var crawlerUserAgents = []string{
 }
 
 func shouldPrerender(r *http.Request) bool {
+	// Tracking redirects must reach the app so bot clicks are logged, and
+	// crawlers need the real sitemap and images
+	if strings.HasPrefix(r.URL.Path, "/go/") || strings.HasPrefix(r.URL.Path, "/media/") || r.URL.Path == "/sitemap.xml" {
+		return false
+	}
 	ua := strings.ToLower(r.Header.Get("User-Agent"))
 	for _, bot := range crawlerUserAgents {
 		if strings.Contains(ua, bot) {
@@ -29,19 +36,32 @@ func PrerenderMiddleware(next http.Handler) http.Handler {
 
 			req, _ := http.NewRequest("GET", prerenderUrl, nil)
 			req.Header.Set("User-Agent", r.Header.Get("User-Agent"))
+			// Let the rendered page pick the crawler's language (?lang= is kept
+			// in the URL) and keep per-language copies apart in caches
+			if lang := r.Header.Get("Accept-Language"); lang != "" {
+				req.Header.Set("Accept-Language", lang)
+			}
 			req.Header.Set("X-Prerender-Token", "JTv89Qhqb1AdhaDBRDj9") // replace this
 
 			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
-				log.Println("Error calling Prerender.io:", err)
+				logger.FromContext(r.Context()).Error("Error calling Prerender.io", "error", err)
+				metrics.PrerenderRequestsTotal.WithLabelValues("error").Inc()
 				next.ServeHTTP(w, r)
 				return
 			}
 			defer resp.Body.Close()
 
+			outcome := "success"
+			if resp.StatusCode >= 400 {
+				outcome = "upstream_error"
+			}
+			metrics.PrerenderRequestsTotal.WithLabelValues(outcome).Inc()
+
 			for k, v := range resp.Header {
 				w.Header().Set(k, v[0])
 			}
+			w.Header().Add("Vary", "Accept-Language")
 			w.WriteHeader(resp.StatusCode)
 			io.Copy(w, resp.Body)
 			return
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// APIKey authenticates machine-to-machine clients via the X-API-Key header.
+// The full key is only shown once at creation; Prefix identifies it in lists
+// and logs and KeyHash is used to verify it.
+type APIKey struct {
+	ID          uint         `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string       `json:"name" gorm:"type:varchar(255);not null"`
+	Prefix      string       `json:"prefix" gorm:"type:varchar(32);uniqueIndex;not null"`
+	KeyHash     string       `json:"-" gorm:"type:char(64);not null"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:api_key_permissions;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	AllowedIPs  string       `json:"allowed_ips" gorm:"type:varchar(1024)"` // comma separated IPs / CIDRs, empty = any
+	ExpiresAt   *time.Time   `json:"expires_at"`
+	LastUsedAt  *time.Time   `json:"last_used_at"`
+	LastUsedIP  string       `json:"last_used_ip" gorm:"type:varchar(64)"`
+	RevokedAt   *time.Time   `json:"revoked_at"`
+	CreatedBy   uint         `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// HasPermission reports whether the key was granted the named permission,
+// directly or through a wildcard
+func (k *APIKey) HasPermission(name string) bool {
+	for _, p := range k.Permissions {
+		if PermissionMatches(p.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditLogImmutable = errors.New("audit log entries are append-only")
+
+// AuditLog records one administrative change. Before, After and Diff hold
+// JSON documents.
+type AuditLog struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ActorType    string    `json:"actor_type" gorm:"type:varchar(16);not null"` // user, api_key, anonymous
+	ActorID      uint      `json:"actor_id" gorm:"index"`
+	ActorName    string    `json:"actor_name" gorm:"type:varchar(255)"`
+	IP           string    `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent    string    `json:"user_agent" gorm:"type:varchar(512)"`
+	RequestID    string    `json:"request_id" gorm:"type:varchar(128)"`
+	Action       string    `json:"action" gorm:"type:varchar(64);index;not null"`
+	ResourceType string    `json:"resource_type" gorm:"type:varchar(64);index:idx_audit_resource;not null"`
+	ResourceID   string    `json:"resource_id" gorm:"type:varchar(64);index:idx_audit_resource"`
+	Before       string    `json:"before" gorm:"type:longtext"`
+	After        string    `json:"after" gorm:"type:longtext"`
+	Diff         string    `json:"diff" gorm:"type:longtext"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+func (AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogImmutable
+}
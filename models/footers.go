@@ -7,5 +7,6 @@ type Footers struct {
 	Name      string    `json:"name" gorm:"type:varchar(255);not null"`
 	ImageURL  string    `json:"image_url" gorm:"type:varchar(512)"`
 	Redirect  string    `json:"redirect" gorm:"type:varchar(512)"`
+	Position  int       `json:"position" gorm:"not null;default:0;index"` // manual order, ascending
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
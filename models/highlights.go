@@ -3,10 +3,18 @@ package models
 import "time"
 
 type Highlights struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Image     string    `json:"image"`
-	Content   string    `json:"content"`
-	CreatedBy string    `json:"created_by"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ID            int       `json:"id"`
+	Title         string    `json:"title"`
+	Image         string    `json:"image"`
+	Content       string    `json:"content"`                                                      // sanitized HTML
+	ContentFormat string    `json:"content_format" gorm:"type:varchar(16);not null;default:html"` // html or markdown
+	ContentSource string    `json:"content_source,omitempty" gorm:"type:longtext"`                // Markdown source, kept for re-editing
+	ReadingTime   int       `json:"reading_time"`                                                 // minutes
+	Position      int       `json:"position" gorm:"not null;default:0;index"`                     // manual order, ascending
+	CreatedBy     string    `json:"created_by"`
+	CreatedByID   uint      `json:"created_by_id" gorm:"index"`
+	UpdatedBy     string    `json:"updated_by"`
+	UpdatedByID   uint      `json:"updated_by_id"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Invitation lets an admin onboard a user into a given role; only the token
+// hash is stored
+type Invitation struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email          string     `json:"email" gorm:"type:varchar(191);index;not null"`
+	RoleID         uint       `json:"role_id" gorm:"not null"`
+	Role           Role       `json:"role"`
+	TokenHash      string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	InvitedBy      uint       `json:"invited_by"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	AcceptedUserID *uint      `json:"accepted_user_id"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Pending reports whether the invitation can still be redeemed
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && i.ExpiresAt.After(now)
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LoginThrottle tracks consecutive failed logins per key ("ip:..." or "user:...")
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Key           string     `json:"key" gorm:"type:varchar(191);uniqueIndex;not null"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// LoginAttempt is the audit trail of every login attempt
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username  string    `json:"username" gorm:"type:varchar(191);index"`
+	IP        string    `json:"ip" gorm:"type:varchar(64);index"`
+	UserAgent string    `json:"user_agent" gorm:"type:varchar(512)"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason" gorm:"type:varchar(64)"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
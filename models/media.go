@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Media sources
+const (
+	MediaEmbedded = "embedded" // extracted from an inline data: URI and stored locally
+	MediaExternal = "external" // referenced by URL, not stored by us
+)
+
+// Media is an image in the media library. Stored files are deduplicated by
+// content hash; external images by URL.
+type Media struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	URL         string    `json:"url" gorm:"type:varchar(1024);not null"`
+	URLHash     string    `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Source      string    `json:"source" gorm:"type:varchar(16);index;not null"`
+	Filename    string    `json:"filename,omitempty" gorm:"type:varchar(128)"` // file in MEDIA_DIR, embedded only
+	MimeType    string    `json:"mime_type,omitempty" gorm:"type:varchar(64)"`
+	Size        int64     `json:"size,omitempty"`
+	SHA256      string    `json:"sha256,omitempty" gorm:"type:char(64);index"`
+	Usages      int64     `json:"usages" gorm:"-"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedByID uint      `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// MediaUsage records that one locale of a content item references a media
+// item, so images still in use are never deleted
+type MediaUsage struct {
+	ID           uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	MediaID      uint   `json:"media_id" gorm:"not null;uniqueIndex:idx_media_usage;index"`
+	ResourceType string `json:"resource_type" gorm:"type:varchar(32);not null;uniqueIndex:idx_media_usage;index:idx_media_usage_resource"`
+	ResourceID   uint   `json:"resource_id" gorm:"not null;uniqueIndex:idx_media_usage;index:idx_media_usage_resource"`
+	Locale       string `json:"locale" gorm:"type:varchar(8);not null;uniqueIndex:idx_media_usage"`
+}
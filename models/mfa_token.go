@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// UsedMFAToken records an intermediate login token that completed a login,
+// so it can't be used again before it expires
+type UsedMFAToken struct {
+	ID        string    `json:"id" gorm:"type:varchar(64);primaryKey"` // the token's "jti" claim
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -1,8 +1,26 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"strings"
 
+	"gorm.io/gorm"
+)
+
+// Permission names may be wildcards: "news.*" grants every permission under
+// "news." and "*" grants everything
 type Permission struct {
 	gorm.Model
 	Name string `gorm:"unique"`
 }
+
+// PermissionMatches reports whether the granted permission (possibly a
+// wildcard) covers name
+func PermissionMatches(granted, name string) bool {
+	if granted == "*" || granted == name {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(granted, "*"); ok && strings.HasSuffix(prefix, ".") {
+		return strings.HasPrefix(name, prefix)
+	}
+	return false
+}
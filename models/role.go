@@ -5,5 +5,14 @@ import "gorm.io/gorm"
 type Role struct {
 	gorm.Model
 	Name        string       `gorm:"unique"`
+	Require2FA  bool         `json:"require_2fa" gorm:"column:require_2fa;default:false"`
 	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	// Roles inherit every permission of their parent (and its ancestors)
+	ParentID *uint `json:"parent_id" gorm:"index"`
+	Parent   *Role `json:"parent,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+
+	// PermissionVersion is bumped whenever the role's permissions change and
+	// is embedded in access tokens as "perm_version"
+	PermissionVersion uint `json:"permission_version" gorm:"default:0"`
 }
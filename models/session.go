@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session is one login on one device. Its ID is carried in the "sid" claim of
+// the access and refresh tokens issued for it, so revoking the session
+// invalidates both.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(512)"`
+	Device     string     `json:"device" gorm:"type:varchar(128)"` // e.g. "Chrome on Windows"
+	IP         string     `json:"ip" gorm:"type:varchar(64)"`
+	LastSeenIP string     `json:"last_seen_ip" gorm:"type:varchar(64)"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the session can still be used at now
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(now)
+}
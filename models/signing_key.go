@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SigningKey is an asymmetric JWT signing key. The newest non-retired key
+// signs new tokens; retired keys stay published in the JWKS and valid for
+// verification until ExpiresAt so outstanding tokens keep working.
+type SigningKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kid        string     `json:"kid" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Algorithm  string     `json:"algorithm" gorm:"type:varchar(16);not null"`
+	PrivateKey string     `json:"-" gorm:"type:text;not null"` // PKCS#8 PEM, AES-GCM sealed ("enc:v1:...") when JWT_KEY_ENCRYPTION_KEY is set
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	RetiredAt  *time.Time `json:"retired_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// SponsorClick is one click through /go/sponsor/{id}. The IP is stored only
+// as a salted hash that changes daily.
+type SponsorClick struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	SponsorID uint      `json:"sponsor_id" gorm:"index:idx_sponsor_click_day;not null"`
+	Slot      string    `json:"slot" gorm:"type:varchar(16)"`
+	Referrer  string    `json:"referrer" gorm:"type:varchar(512)"`
+	IPHash    string    `json:"ip_hash" gorm:"type:char(64)"`
+	UserAgent string    `json:"user_agent" gorm:"type:varchar(512)"`
+	IsBot     bool      `json:"is_bot"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_sponsor_click_day"`
+}
+
+// SponsorDailyStat aggregates a sponsor's impressions and clicks per day.
+// Impressions are counted directly by the beacon; click columns are rebuilt
+// from SponsorClick by the rollup.
+type SponsorDailyStat struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	SponsorID      uint      `json:"sponsor_id" gorm:"uniqueIndex:idx_sponsor_day;not null"`
+	Date           time.Time `json:"date" gorm:"type:date;uniqueIndex:idx_sponsor_day;not null"`
+	Impressions    int64     `json:"impressions" gorm:"not null;default:0"`
+	BotImpressions int64     `json:"bot_impressions" gorm:"not null;default:0"`
+	Clicks         int64     `json:"clicks" gorm:"not null;default:0"` // human clicks only
+	UniqueClicks   int64     `json:"unique_clicks" gorm:"not null;default:0"`
+	BotClicks      int64     `json:"bot_clicks" gorm:"not null;default:0"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -1,11 +1,83 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// Placement slots a sponsor can be shown in
+const (
+	SponsorSlotHeader  = "header"
+	SponsorSlotSidebar = "sidebar"
+	SponsorSlotFooter  = "footer"
+)
+
+var SponsorSlots = []string{SponsorSlotHeader, SponsorSlotSidebar, SponsorSlotFooter}
+
+// Campaign statuses; a paused campaign is hidden regardless of its dates
+const (
+	SponsorStatusActive = "active"
+	SponsorStatusPaused = "paused"
+)
 
 type Sponsors struct {
-	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
-	Name      string    `json:"name" gorm:"type:varchar(255);not null"`
-	ImageURL  string    `json:"image_url" gorm:"type:varchar(512)"`
-	Redirect  string    `json:"redirect" gorm:"type:varchar(512)"`
+	ID       uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name     string `json:"name" gorm:"type:varchar(255);not null"`
+	ImageURL string `json:"image_url" gorm:"type:varchar(512)"`
+	Redirect string `json:"redirect" gorm:"type:varchar(512)"`
+
+	Position int `json:"position" gorm:"not null;default:0"` // manual order within a priority tier
+
+	// Campaign scheduling and placement
+	Slot     string     `json:"slot" gorm:"type:varchar(16);not null;default:sidebar;index:idx_sponsor_live"`
+	Status   string     `json:"status" gorm:"type:varchar(16);not null;default:active;index:idx_sponsor_live"`
+	Priority int        `json:"priority" gorm:"not null;default:0"` // higher tiers are always listed first
+	Weight   int        `json:"weight" gorm:"not null;default:1"`   // share of rotation within a tier
+	StartsAt *time.Time `json:"starts_at"`                          // nil = already started
+	EndsAt   *time.Time `json:"ends_at"`                            // nil = open-ended
+
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// ValidSponsorSlot reports whether slot is a known placement
+func ValidSponsorSlot(slot string) bool {
+	for _, s := range SponsorSlots {
+		if s == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize fills campaign defaults and validates the campaign settings
+func (s *Sponsors) Normalize() error {
+	if s.Slot == "" {
+		s.Slot = SponsorSlotSidebar
+	}
+	if s.Status == "" {
+		s.Status = SponsorStatusActive
+	}
+	if s.Weight == 0 {
+		s.Weight = 1
+	}
+
+	switch {
+	case !ValidSponsorSlot(s.Slot):
+		return errors.New("slot must be one of header, sidebar, footer")
+	case s.Status != SponsorStatusActive && s.Status != SponsorStatusPaused:
+		return errors.New("status must be active or paused")
+	case s.Weight < 0:
+		return errors.New("weight must be positive")
+	case s.StartsAt != nil && s.EndsAt != nil && !s.EndsAt.After(*s.StartsAt):
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// Live reports whether the campaign should be shown at now
+func (s *Sponsors) Live(now time.Time) bool {
+	return s.Status == SponsorStatusActive &&
+		(s.StartsAt == nil || !s.StartsAt.After(now)) &&
+		(s.EndsAt == nil || s.EndsAt.After(now))
 }
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// Translation holds one locale's text for a content item. The item itself
+// stores the default locale; empty fields here fall back to it. Which fields
+// apply depends on ResourceType (news: title/detail/content, highlights:
+// title/content, footers and sponsors: name).
+type Translation struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ResourceType  string    `json:"resource_type" gorm:"type:varchar(32);not null;uniqueIndex:idx_translation"`
+	ResourceID    uint      `json:"resource_id" gorm:"not null;uniqueIndex:idx_translation"`
+	Locale        string    `json:"locale" gorm:"type:varchar(8);not null;uniqueIndex:idx_translation"`
+	Title         string    `json:"title,omitempty" gorm:"type:varchar(512)"`
+	Detail        string    `json:"detail,omitempty" gorm:"type:text"`
+	Content       string    `json:"content,omitempty" gorm:"type:longtext"`
+	ContentFormat string    `json:"content_format,omitempty" gorm:"type:varchar(16)"` // html or markdown; defaults to the item's
+	ContentSource string    `json:"content_source,omitempty" gorm:"type:longtext"`    // Markdown source, kept for re-editing
+	Name          string    `json:"name,omitempty" gorm:"type:varchar(255)"`
+	UpdatedBy     string    `json:"updated_by"`
+	UpdatedByID   uint      `json:"updated_by_id"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Translatable is implemented by content models that have translations
+type Translatable interface {
+	TranslationKey() (resourceType string, id uint)
+	ApplyTranslation(t *Translation)
+}
+
+func override(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+func (n *News) TranslationKey() (string, uint) { return "news", uint(n.ID) }
+
+// overrideContent swaps in translated content with its own format and
+// Markdown source, so the three never come from different locales.
+// Translations saved before formats were recorded are HTML.
+func overrideContent(content, format, source *string, t *Translation) {
+	if t.Content == "" {
+		return
+	}
+	*content, *source = t.Content, t.ContentSource
+	*format = t.ContentFormat
+	if *format == "" {
+		*format = "html"
+	}
+}
+
+func (n *News) ApplyTranslation(t *Translation) {
+	override(&n.Title, t.Title)
+	override(&n.Detail, t.Detail)
+	overrideContent(&n.Content, &n.ContentFormat, &n.ContentSource, t)
+}
+
+func (h *Highlights) TranslationKey() (string, uint) { return "highlights", uint(h.ID) }
+
+func (h *Highlights) ApplyTranslation(t *Translation) {
+	override(&h.Title, t.Title)
+	overrideContent(&h.Content, &h.ContentFormat, &h.ContentSource, t)
+}
+
+func (f *Footers) TranslationKey() (string, uint) { return "footers", f.ID }
+
+func (f *Footers) ApplyTranslation(t *Translation) {
+	override(&f.Name, t.Name)
+}
+
+func (s *Sponsors) TranslationKey() (string, uint) { return "sponsors", s.ID }
+
+func (s *Sponsors) ApplyTranslation(t *Translation) {
+	override(&s.Name, t.Name)
+}
@@ -5,7 +5,14 @@ import "gorm.io/gorm"
 type User struct {
 	gorm.Model
 	Username string `gorm:"unique"`
+	Email    string `json:"email" gorm:"type:varchar(191);index"`
 	Password string
 	RoleID   uint
 	Role     Role
+
+	// TOTP two-factor authentication. TOTPSecret is set on setup and only
+	// takes effect once TOTPEnabled is true.
+	TOTPSecret       string `json:"-" gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPEnabled      bool   `json:"totp_enabled" gorm:"column:totp_enabled;default:false"`
+	TOTPLastUsedStep int64  `json:"-" gorm:"column:totp_last_used_step"`
 }
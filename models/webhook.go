@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Webhook is an admin-registered endpoint notified of content events.
+// Secret signs every payload; it is only shown when created or rotated.
+type Webhook struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string    `json:"name" gorm:"type:varchar(255);not null"`
+	URL         string    `json:"url" gorm:"type:varchar(1024);not null"`
+	Secret      string    `json:"-" gorm:"type:varchar(128);not null"`
+	Events      string    `json:"events" gorm:"type:varchar(1024);not null"` // comma separated names or wildcards ("news.*", "*")
+	Active      bool      `json:"active" gorm:"not null;default:true"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedByID uint      `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Subscribes reports whether the webhook wants event
+func (h *Webhook) Subscribes(event string) bool {
+	for _, e := range strings.Split(h.Events, ",") {
+		if PermissionMatches(strings.TrimSpace(e), event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"   // waiting for its first or next attempt
+	DeliverySucceeded = "succeeded" // the endpoint answered 2xx
+	DeliveryFailed    = "failed"    // gave up after the last retry
+)
+
+// WebhookDelivery is one event queued for one webhook. The worker claims
+// due deliveries by setting LockedUntil, so several instances can share the
+// queue.
+type WebhookDelivery struct {
+	ID             uint             `json:"id" gorm:"primaryKey;autoIncrement"`
+	WebhookID      uint             `json:"webhook_id" gorm:"not null;index"`
+	EventID        string           `json:"event_id" gorm:"type:varchar(64);not null;index"`
+	Event          string           `json:"event" gorm:"type:varchar(64);not null;index"`
+	Payload        string           `json:"payload" gorm:"type:longtext;not null"`
+	Status         string           `json:"status" gorm:"type:varchar(16);not null;index:idx_delivery_due"`
+	Attempts       int              `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at" gorm:"index:idx_delivery_due"`
+	LockedUntil    *time.Time       `json:"-"`
+	LastAttemptAt  *time.Time       `json:"last_attempt_at"`
+	ResponseStatus int              `json:"response_status"`
+	LastError      string           `json:"last_error" gorm:"type:text"`
+	RedeliveryOf   *uint            `json:"redelivery_of"`
+	AttemptLog     []WebhookAttempt `json:"attempts_log,omitempty" gorm:"foreignKey:DeliveryID;constraint:OnDelete:CASCADE"`
+	CreatedAt      time.Time        `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time        `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// WebhookAttempt logs one HTTP request made for a delivery
+type WebhookAttempt struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	DeliveryID   uint      `json:"delivery_id" gorm:"not null;index"`
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body" gorm:"type:text"` // truncated
+	Error        string    `json:"error" gorm:"type:text"`
+	DurationMs   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,62 @@
+package policy
+
+import "sync"
+
+// Subject is the caller an authorization decision is made for
+type Subject interface {
+	// UserID is 0 for non-user callers such as API keys
+	UserID() uint
+	HasPermission(name string) bool
+}
+
+// Resource describes the object being acted on
+type Resource struct {
+	Type    string // e.g. "news", "highlights"
+	OwnerID uint   // user who created it, 0 if unknown
+}
+
+// Rule grants Action on resources of Type to subjects holding Permission,
+// provided Condition (if any) holds
+type Rule struct {
+	Type       string
+	Action     string
+	Permission string
+	Condition  func(s Subject, r Resource) bool
+}
+
+// IsOwner is a Condition restricting a rule to the resource's creator
+func IsOwner(s Subject, r Resource) bool {
+	return s.UserID() != 0 && r.OwnerID == s.UserID()
+}
+
+var (
+	mu    sync.RWMutex
+	rules []Rule
+)
+
+// Register adds rules to the engine
+func Register(rs ...Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = append(rules, rs...)
+}
+
+// Allow reports whether s may perform action on r. Access is denied unless
+// at least one rule allows it.
+func Allow(s Subject, action string, r Resource) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, rule := range rules {
+		if rule.Type != r.Type || rule.Action != action {
+			continue
+		}
+		if !s.HasPermission(rule.Permission) {
+			continue
+		}
+		if rule.Condition == nil || rule.Condition(s, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package policy
+
+// Content editing rules: "<type>.<action>" lets editors act on every item,
+// "<type>.<action>.own" lets authors act only on items they created. Site
+// settings (footers, sponsors) have no authorship, so only the first applies.
+func init() {
+	for _, t := range []string{"news", "highlights"} {
+		Register(Rule{Type: t, Action: "create", Permission: t + ".create"})
+		for _, action := range []string{"update", "delete"} {
+			Register(
+				Rule{Type: t, Action: action, Permission: t + "." + action},
+				Rule{Type: t, Action: action, Permission: t + "." + action + ".own", Condition: IsOwner},
+			)
+		}
+	}
+
+	for _, t := range []string{"footers", "sponsors"} {
+		for _, action := range []string{"create", "update", "delete"} {
+			Register(Rule{Type: t, Action: action, Permission: t + "." + action})
+		}
+	}
+}
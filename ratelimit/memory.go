@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in process memory. Limits are per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time // when the bucket will have refilled, so it can be dropped
+}
+
+// NewMemoryStore creates a store and starts a janitor that drops buckets
+// once they have refilled, since a full bucket is the same as a missing one
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{buckets: map[string]*memoryBucket{}}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			s.sweep(now)
+		}
+	}()
+	return s
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: bucket{tokens: float64(policy.Burst), last: now}}
+		s.buckets[key] = b
+	}
+
+	res := b.take(policy, now)
+	b.fullAt = now.Add(res.Reset)
+	return res, nil
+}
@@ -0,0 +1,101 @@
+// Package ratelimit implements token-bucket rate limiting. Buckets live in a
+// Store so the in-memory implementation can be swapped for a shared one
+// (e.g. Redis) when running several instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy allows Requests per Window on average, with bursts of up to Burst
+type Policy struct {
+	Name     string
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+// rate is the bucket refill rate in tokens per second
+func (p Policy) rate() float64 {
+	return float64(p.Requests) / p.Window.Seconds()
+}
+
+// Header formats the policy for the RateLimit-Policy response header
+func (p Policy) Header() string {
+	return fmt.Sprintf("%d;w=%d;burst=%d", p.Requests, int(p.Window.Seconds()), p.Burst)
+}
+
+// PolicyFromEnv builds a policy, letting RATE_LIMIT_<NAME>_REQUESTS,
+// RATE_LIMIT_<NAME>_WINDOW_SECONDS and RATE_LIMIT_<NAME>_BURST override the
+// defaults. Burst defaults to the request count.
+func PolicyFromEnv(name string, requests int, window time.Duration, burst int) Policy {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(name) + "_"
+	if v, err := strconv.Atoi(os.Getenv(prefix + "REQUESTS")); err == nil && v > 0 {
+		requests = v
+		burst = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "WINDOW_SECONDS")); err == nil && v > 0 {
+		window = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "BURST")); err == nil && v > 0 {
+		burst = v
+	}
+	if burst <= 0 {
+		burst = requests
+	}
+	return Policy{Name: name, Requests: requests, Window: window, Burst: burst}
+}
+
+// Enabled reports whether rate limiting is on (RATE_LIMIT_ENABLED, default true)
+func Enabled() bool {
+	return os.Getenv("RATE_LIMIT_ENABLED") != "false"
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// Store holds token buckets
+type Store interface {
+	// Take removes one token from key's bucket under policy
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+// bucket is a token bucket's persisted state
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket up to now and removes a token if one is available
+func (b *bucket) take(policy Policy, now time.Time) Result {
+	rate := policy.rate()
+	capacity := float64(policy.Burst)
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+		b.last = now
+	}
+
+	res := Result{Limit: policy.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = time.Duration((capacity - b.tokens) / rate * float64(time.Second))
+	return res
+}
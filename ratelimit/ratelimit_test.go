@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	// One token a second, bursts of three
+	policy := Policy{Name: "test", Requests: 10, Window: 10 * time.Second, Burst: 3}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type take struct {
+		key        string
+		at         time.Duration // since base
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{"burst then refusal", []take{
+			{"a", 0, true, 2, 0, time.Second},
+			{"a", 0, true, 1, 0, 2 * time.Second},
+			{"a", 0, true, 0, 0, 3 * time.Second},
+			{"a", 0, false, 0, time.Second, 3 * time.Second},
+		}},
+		{"partial refill", []take{
+			{"a", 0, true, 2, 0, time.Second},
+			{"a", 0, true, 1, 0, 2 * time.Second},
+			{"a", 0, true, 0, 0, 3 * time.Second},
+			{"a", 500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+			{"a", time.Second, true, 0, 0, 3 * time.Second},
+		}},
+		{"refill caps at burst", []take{
+			{"a", 0, true, 2, 0, time.Second},
+			{"a", time.Hour, true, 2, 0, time.Second},
+		}},
+		{"keys are separate", []take{
+			{"a", 0, true, 2, 0, time.Second},
+			{"a", 0, true, 1, 0, 2 * time.Second},
+			{"a", 0, true, 0, 0, 3 * time.Second},
+			{"b", 0, true, 2, 0, time.Second},
+		}},
+		{"clock going backwards", []take{
+			{"a", time.Second, true, 2, 0, time.Second},
+			{"a", 0, true, 1, 0, 2 * time.Second},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &MemoryStore{buckets: map[string]*memoryBucket{}}
+			for i, tk := range tt.takes {
+				res, err := s.Take(context.Background(), tk.key, policy, base.Add(tk.at))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := Result{Allowed: tk.allowed, Limit: policy.Burst, Remaining: tk.remaining, Reset: tk.reset, RetryAfter: tk.retryAfter}
+				if res != want {
+					t.Fatalf("take %d = %+v, want %+v", i+1, res, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	policy := Policy{Name: "test", Requests: 1, Window: time.Second, Burst: 2}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		at   time.Duration // sweep time since the take
+		kept bool
+	}{
+		{"still refilling", 500 * time.Millisecond, true},
+		{"just full", time.Second, false},
+		{"long after", time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &MemoryStore{buckets: map[string]*memoryBucket{}}
+			s.Take(context.Background(), "a", policy, base)
+			s.sweep(base.Add(tt.at))
+			if _, ok := s.buckets["a"]; ok != tt.kept {
+				t.Fatalf("bucket kept = %v, want %v", ok, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package richtext
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	mdhtml "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/net/html/atom"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Input formats
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+)
+
+var ErrUnknownFormat = errors.New("content_format must be html or markdown")
+
+// Raw HTML in Markdown is passed through: Prepare sanitizes it afterwards
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(mdhtml.WithUnsafe()),
+)
+
+// Document is processed content ready to store
+type Document struct {
+	HTML        string   // sanitized HTML
+	Text        string   // plain text of HTML
+	ReadingTime int      // minutes, at least 1 for non-empty text
+	Images      []string // distinct <img> sources in document order
+}
+
+// Render converts source in the given format (empty means html) to HTML.
+// The result is not yet sanitized.
+func Render(format, source string) (string, error) {
+	switch format {
+	case "", FormatHTML:
+		return source, nil
+	case FormatMarkdown:
+		var buf bytes.Buffer
+		if err := markdown.Convert([]byte(source), &buf); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Prepare sanitizes rendered HTML and derives its text, reading time and
+// images. Markdown output goes through here too, so raw HTML inside Markdown
+// gets the same allowlist.
+func Prepare(rendered string) Document {
+	doc := Document{HTML: Sanitize(rendered)}
+	doc.Text = PlainText(doc.HTML)
+	doc.ReadingTime = ReadingTime(doc.Text)
+	doc.Images = Images(doc.HTML)
+	return doc
+}
+
+// PlainText returns the whitespace-normalized text content of HTML
+func PlainText(fragment string) string {
+	var b strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case xhtml.TextToken:
+			b.Write(z.Text())
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			// Block boundaries separate words
+			b.WriteByte(' ')
+		}
+	}
+}
+
+// Images returns the distinct image sources in an HTML fragment
+func Images(fragment string) []string {
+	var images []string
+	seen := make(map[string]bool)
+	z := xhtml.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			return images
+		}
+		if tt != xhtml.StartTagToken && tt != xhtml.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if atom.Lookup(name) != atom.Img {
+			continue
+		}
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			if string(key) == "src" {
+				if src := strings.TrimSpace(string(val)); src != "" && !seen[src] {
+					seen[src] = true
+					images = append(images, src)
+				}
+			}
+		}
+	}
+}
+
+// ExcerptLength is the excerpt size in characters (CONTENT_EXCERPT_LENGTH,
+// default 200)
+func ExcerptLength() int {
+	if n, err := strconv.Atoi(os.Getenv("CONTENT_EXCERPT_LENGTH")); err == nil && n > 0 {
+		return n
+	}
+	return 200
+}
+
+// Excerpt shortens plain text to at most n characters, cutting at a word
+// boundary where the script has one, and HTML-escapes it
+func Excerpt(text string, n int) string {
+	rs := []rune(text)
+	if len(rs) <= n {
+		return html.EscapeString(text)
+	}
+	cut := n
+	for i := n; i > n*2/3; i-- {
+		if unicode.IsSpace(rs[i]) {
+			cut = i
+			break
+		}
+	}
+	return html.EscapeString(strings.TrimRightFunc(string(rs[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})) + "…"
+}
+
+// Reading speeds. Scripts written without spaces are counted per character.
+const (
+	wordsPerMinute = 220
+	charsPerMinute = 500
+)
+
+// ReadingTime estimates minutes needed to read text
+func ReadingTime(text string) int {
+	words, chars := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Khmer, unicode.Thai, unicode.Lao, unicode.Myanmar):
+			if !unicode.IsMark(r) {
+				chars++
+			}
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		case unicode.IsMark(r):
+		default:
+			inWord = false
+		}
+	}
+	if words == 0 && chars == 0 {
+		return 0
+	}
+	minutes := float64(words)/wordsPerMinute + float64(chars)/charsPerMinute
+	return max(1, int(math.Ceil(minutes)))
+}
@@ -0,0 +1,55 @@
+package richtext
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"formatting kept", `<p>Hello <b>world</b></p>`, `<p>Hello <b>world</b></p>`},
+		{"script dropped", `<script>alert(1)</script><p>ok</p>`, `<p>ok</p>`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `x`},
+		{"external link", `<a href="https://example.com">x</a>`, `<a href="https://example.com" rel="nofollow noopener" target="_blank">x</a>`},
+		{"relative link", `<a href="/news/1">x</a>`, `<a href="/news/1" rel="nofollow">x</a>`},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`, `<img src="x.png">`},
+		{"style and class", `<p style="color:red" class="c">t</p>`, `<p>t</p>`},
+		{"figure", `<figure><img src="a.png" alt="a"><figcaption>cap</figcaption></figure>`, `<figure><img src="a.png" alt="a"><figcaption>cap</figcaption></figure>`},
+		{"mark", `<mark>hi</mark>`, `<mark>hi</mark>`},
+		{"iframe without allowed hosts", `<iframe src="https://www.youtube.com/embed/x"></iframe>`, ``},
+		{"surrounding space", "  <p>pad</p>\n", `<p>pad</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Fatalf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		n    int
+		want string
+	}{
+		{"short", "short", 10, "short"},
+		{"exact length", "exactly ten", 11, "exactly ten"},
+		{"word boundary", "hello world foo bar", 12, "hello world…"},
+		{"trailing punctuation", "hello, world, foo", 13, "hello, world…"},
+		{"no space to cut at", "abcdefghijklmnop", 10, "abcdefghij…"},
+		{"runes not bytes", "日本語のテキストです", 5, "日本語のテ…"},
+		{"escaped", "a <b> & c d e f g", 9, "a &lt;b&gt; &amp; c…"},
+		{"escaped when short", "<b>", 10, "&lt;b&gt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Excerpt(tt.text, tt.n); got != tt.want {
+				t.Fatalf("Excerpt(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+			}
+		})
+	}
+}
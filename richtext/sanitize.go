@@ -0,0 +1,69 @@
+// Package richtext prepares editor-supplied content for storage: Markdown
+// rendering, allowlist HTML sanitization, excerpts, reading time and the
+// images a document embeds.
+package richtext
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+var (
+	policyOnce sync.Once
+	policy     *bluemonday.Policy
+)
+
+func envList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Policy returns the sanitizer allowlist. It starts from bluemonday's
+// user-generated-content policy (formatting, links, images, tables; no
+// scripts, styles or event handlers) and is extended by:
+//
+//	CONTENT_HTML_ALLOW_ELEMENTS   extra elements, e.g. "figure, figcaption"
+//	CONTENT_HTML_ALLOW_ATTRS      extra attributes on any element, e.g. "class"
+//	CONTENT_HTML_IFRAME_HOSTS     hosts whose https iframes are kept, e.g.
+//	                              "www.youtube.com, player.vimeo.com"
+func Policy() *bluemonday.Policy {
+	policyOnce.Do(func() {
+		p := bluemonday.UGCPolicy()
+		p.AllowElements("figure", "figcaption", "mark")
+		p.AddTargetBlankToFullyQualifiedLinks(true)
+
+		if elements := envList("CONTENT_HTML_ALLOW_ELEMENTS"); len(elements) > 0 {
+			p.AllowElements(elements...)
+		}
+		if attrs := envList("CONTENT_HTML_ALLOW_ATTRS"); len(attrs) > 0 {
+			p.AllowAttrs(attrs...).Globally()
+		}
+		if hosts := envList("CONTENT_HTML_IFRAME_HOSTS"); len(hosts) > 0 {
+			quoted := make([]string, len(hosts))
+			for i, h := range hosts {
+				quoted[i] = regexp.QuoteMeta(h)
+			}
+			src := regexp.MustCompile(`^https://(` + strings.Join(quoted, "|") + `)/`)
+			p.AllowElements("iframe")
+			p.AllowAttrs("src").Matching(src).OnElements("iframe")
+			p.AllowAttrs("width", "height").Matching(bluemonday.Number).OnElements("iframe")
+			p.AllowAttrs("allowfullscreen", "title").OnElements("iframe")
+		}
+		policy = p
+	})
+	return policy
+}
+
+// Sanitize strips everything outside the allowlist from an HTML fragment
+func Sanitize(html string) string {
+	return strings.TrimSpace(Policy().Sanitize(html))
+}
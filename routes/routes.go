@@ -1,55 +1,71 @@
 package routes
 
 import (
+	"net/http"
+	"time"
+
 	"wwb99/controllers"
+	"wwb99/metrics"
 	"wwb99/middleware"
+	"wwb99/ratelimit"
 
 	"github.com/gorilla/mux"
 )
 
+// guard wraps a handler with a permission check
+func guard(permission string, h http.HandlerFunc) http.Handler {
+	return middleware.RequirePermission(permission)(h)
+}
+
 func RegisterRoutes() *mux.Router {
+	// Rate limits: a generous per-IP quota for everything, a strict one for
+	// credential endpoints and a per-user/API-key quota for authenticated calls
+	limiter := middleware.NewRateLimiter(ratelimit.NewMemoryStore())
+	publicLimit := limiter.Limit(ratelimit.PolicyFromEnv("public", 300, time.Minute, 100), middleware.KeyByIP)
+	authLimit := limiter.Limit(ratelimit.PolicyFromEnv("auth", 20, time.Minute, 10), middleware.KeyByIP)
+	apiLimit := limiter.Limit(ratelimit.PolicyFromEnv("api", 600, time.Minute, 200), middleware.KeyByClient)
+	strict := func(h http.HandlerFunc) http.Handler { return authLimit(h) }
+
 	r := mux.NewRouter()
+	r.Use(middleware.TagRoute, middleware.MetricsMiddleware, publicLimit)
+
+	r.Handle("/metrics", middleware.MetricsAuth(metrics.Handler())).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", controllers.GetJWKS).Methods("GET")
+	r.HandleFunc("/sitemap.xml", controllers.GetSitemap).Methods("GET")
+	r.PathPrefix("/media/").Handler(controllers.ServeMedia()).Methods("GET")
 
 	// start admin
-	r.HandleFunc("/api/register", controllers.Register).Methods("POST")
-	r.HandleFunc("/api/login", controllers.Login).Methods("POST")
-	r.HandleFunc("/api/refresh", controllers.RefreshToken).Methods("POST")
+	r.Handle("/api/register", strict(controllers.Register)).Methods("POST")
+	r.Handle("/api/login", strict(controllers.Login)).Methods("POST")
+	r.Handle("/api/login/2fa", strict(controllers.LoginTwoFactor)).Methods("POST")
+	r.Handle("/api/login/2fa/setup", strict(controllers.LoginTwoFactorSetup)).Methods("POST")
+	r.Handle("/api/refresh", strict(controllers.RefreshToken)).Methods("POST")
+	r.Handle("/api/password/forgot", strict(controllers.ForgotPassword)).Methods("POST")
+	r.Handle("/api/password/reset", strict(controllers.ResetPassword)).Methods("POST")
+	r.Handle("/api/invitations/lookup", strict(controllers.GetInvitationByToken)).Methods("GET")
+	r.Handle("/api/invitations/accept", strict(controllers.AcceptInvitation)).Methods("POST")
+
+	r.HandleFunc("/api/search", controllers.Search).Methods("GET")
 
 	r.HandleFunc("/api/news", controllers.GetNews).Methods("GET")
-	r.HandleFunc("/api/news/create", controllers.CreateNews).Methods("POST")
-	r.HandleFunc("/api/news/update/{id}", controllers.UpdateNews).Methods("PUT")
-	r.HandleFunc("/api/news/delete", controllers.DeleteNews)
 	r.HandleFunc("/api/news/getbyid", controllers.GetNewsByID)
 
 	r.HandleFunc("/api/highlights", controllers.GetHighlights).Methods("GET")
-	r.HandleFunc("/api/highlights/create", controllers.CreateHighlights).Methods("POST")
-	r.HandleFunc("/api/highlights/update", controllers.UpdateHighlights).Methods("PUT")
-	r.HandleFunc("/api/highlights/delete", controllers.DeleteHighlights)
 	r.HandleFunc("/api/highlights/getbyid", controllers.GetHighlightsByID)
 
 	r.HandleFunc("/api/footers", controllers.GetFooters).Methods("GET")
-	r.HandleFunc("/api/footers/create", controllers.CreateFooter).Methods("POST")
-	r.HandleFunc("/api/footers/update", controllers.UpdateFooter).Methods("PUT")
-	r.HandleFunc("/api/footers/delete", controllers.DeleteFooter)
 	r.HandleFunc("/api/footers/getbyid", controllers.GetFooterByID)
 
 	r.HandleFunc("/api/sponsors", controllers.GetSponsors).Methods("GET")
-	r.HandleFunc("/api/sponsors/create", controllers.CreateSponsor).Methods("POST")
-	r.HandleFunc("/api/sponsors/update", controllers.UpdateSponsor).Methods("PUT")
-	r.HandleFunc("/api/sponsors/delete", controllers.DeleteSponsor)
 	r.HandleFunc("/api/sponsors/getbyid", controllers.GetSponsorByID)
+	r.HandleFunc("/api/sponsors/impression", controllers.SponsorImpression).Methods("GET", "POST")
+	r.HandleFunc("/go/sponsor/{id}", controllers.SponsorRedirect).Methods("GET")
 
 	r.HandleFunc("/api/permissions", controllers.GetPermissions).Methods("GET")
-	r.HandleFunc("/api/permissions/create", controllers.CreatePermission).Methods("POST")
-	r.HandleFunc("/api/permissions/update", controllers.UpdatePermission).Methods("PUT")
 
 	r.HandleFunc("/api/roles", controllers.GetRoles).Methods("GET")
-	r.HandleFunc("/api/roles", controllers.CreateRole).Methods("POST")
-	r.HandleFunc("/api/roles", controllers.UpdateRole).Methods("PUT")
-	r.HandleFunc("/api/roles", controllers.DeleteRole).Methods("DELETE")
 	r.HandleFunc("/api/roles/getbyid", controllers.GetRoleByID).Methods("GET")
 	r.HandleFunc("/api/roles/permissions", controllers.GetPermissionRoles).Methods("GET")
-	r.HandleFunc("/api/roles/assign", controllers.AssignPermissions).Methods("PUT")
 
 	// end admin
 
@@ -61,9 +77,95 @@ func RegisterRoutes() *mux.Router {
 
 	// end client
 
+	// Content editing: user tokens or API keys, authorized per item by the
+	// policy engine
 	secured := r.PathPrefix("/api").Subrouter()
-	secured.Use(middleware.AuthMiddleware)
-	secured.HandleFunc("/profile", controllers.Profile).Methods("GET")
+	secured.Use(middleware.AuthMiddleware, apiLimit)
+	secured.HandleFunc("/news/create", controllers.CreateNews).Methods("POST")
+	secured.HandleFunc("/news/update/{id}", controllers.UpdateNews).Methods("PUT")
+	secured.HandleFunc("/news/delete", controllers.DeleteNews)
+	secured.HandleFunc("/highlights/create", controllers.CreateHighlights).Methods("POST")
+	secured.HandleFunc("/highlights/update", controllers.UpdateHighlights).Methods("PUT")
+	secured.HandleFunc("/highlights/delete", controllers.DeleteHighlights)
+	secured.Handle("/highlights/reorder", guard("highlights.update", controllers.ReorderHighlights)).Methods("PUT")
+
+	// Bulk import/export
+	secured.Handle("/news/import", guard("news.import", controllers.ImportNews)).Methods("POST")
+	secured.Handle("/news/export", guard("news.export", controllers.ExportNews)).Methods("GET")
+	secured.Handle("/highlights/import", guard("highlights.import", controllers.ImportHighlights)).Methods("POST")
+	secured.Handle("/highlights/export", guard("highlights.export", controllers.ExportHighlights)).Methods("GET")
+	secured.Handle("/sponsors/import", guard("sponsors.import", controllers.ImportSponsors)).Methods("POST")
+	secured.Handle("/sponsors/export", guard("sponsors.export", controllers.ExportSponsors)).Methods("GET")
+	secured.Handle("/footers/import", guard("footers.import", controllers.ImportFooters)).Methods("POST")
+	secured.Handle("/footers/export", guard("footers.export", controllers.ExportFooters)).Methods("GET")
+
+	// Site settings and access control: gated by a single permission each so
+	// every change is attributable in the audit log
+	secured.Handle("/footers/create", guard("footers.create", controllers.CreateFooter)).Methods("POST")
+	secured.Handle("/footers/update", guard("footers.update", controllers.UpdateFooter)).Methods("PUT")
+	secured.Handle("/footers/delete", guard("footers.delete", controllers.DeleteFooter))
+	secured.Handle("/footers/reorder", guard("footers.update", controllers.ReorderFooters)).Methods("PUT")
+	secured.Handle("/sponsors/create", guard("sponsors.create", controllers.CreateSponsor)).Methods("POST")
+	secured.Handle("/sponsors/update", guard("sponsors.update", controllers.UpdateSponsor)).Methods("PUT")
+	secured.Handle("/sponsors/delete", guard("sponsors.delete", controllers.DeleteSponsor))
+	secured.HandleFunc("/translations", controllers.GetTranslations).Methods("GET")
+	secured.HandleFunc("/translations", controllers.UpsertTranslation).Methods("PUT")
+	secured.HandleFunc("/translations", controllers.DeleteTranslation).Methods("DELETE")
+	secured.Handle("/sponsors/reorder", guard("sponsors.update", controllers.ReorderSponsors)).Methods("PUT")
+	secured.Handle("/sponsors/report", guard("sponsors.report", controllers.GetSponsorReport)).Methods("GET")
+	secured.Handle("/sponsors/report/export", guard("sponsors.report", controllers.ExportSponsorReport)).Methods("GET")
+	secured.Handle("/media", guard("media.view", controllers.GetMedia)).Methods("GET")
+	secured.Handle("/media", guard("media.delete", controllers.DeleteMedia)).Methods("DELETE")
+	secured.Handle("/permissions/create", guard("edit_permissions", controllers.CreatePermission)).Methods("POST")
+	secured.Handle("/permissions/update", guard("edit_permissions", controllers.UpdatePermission)).Methods("PUT")
+	secured.Handle("/roles", guard("edit_roles", controllers.CreateRole)).Methods("POST")
+	secured.Handle("/roles", guard("edit_roles", controllers.UpdateRole)).Methods("PUT")
+	secured.Handle("/roles", guard("delete_roles", controllers.DeleteRole)).Methods("DELETE")
+	secured.Handle("/roles/assign", guard("edit_roles", controllers.AssignPermissions)).Methods("PUT")
+
+	// Account and credential management: human users only, never API keys
+	account := r.PathPrefix("/api").Subrouter()
+	account.Use(middleware.AuthMiddleware, middleware.RequireUser, apiLimit)
+	account.HandleFunc("/profile", controllers.Profile).Methods("GET")
+	account.HandleFunc("/profile/password", controllers.ChangePassword).Methods("PUT")
+	account.HandleFunc("/profile/2fa/setup", controllers.SetupTwoFactor).Methods("POST")
+	account.HandleFunc("/profile/2fa/enable", controllers.EnableTwoFactor).Methods("POST")
+	account.HandleFunc("/profile/2fa/disable", controllers.DisableTwoFactor).Methods("POST")
+	account.HandleFunc("/profile/2fa/recovery-codes", controllers.RegenerateRecoveryCodes).Methods("POST")
+
+	account.HandleFunc("/profile/sessions", controllers.GetSessions).Methods("GET")
+	account.HandleFunc("/profile/sessions", controllers.RevokeSession).Methods("DELETE")
+	account.HandleFunc("/logout", controllers.Logout).Methods("POST")
+
+	account.HandleFunc("/users/permissions", controllers.GetUserPermissions).Methods("GET")
+	account.Handle("/users/sessions", guard("view_users", controllers.GetUserSessions)).Methods("GET")
+	account.Handle("/users/sessions", guard("edit_users", controllers.TerminateUserSessions)).Methods("DELETE")
+
+	account.Handle("/invitations", guard("edit_users", controllers.GetInvitations)).Methods("GET")
+	account.Handle("/invitations", guard("edit_users", controllers.CreateInvitation)).Methods("POST")
+	account.Handle("/invitations", guard("edit_users", controllers.RevokeInvitation)).Methods("DELETE")
+
+	account.Handle("/api-keys", guard("api_keys.manage", controllers.GetAPIKeys)).Methods("GET")
+	account.Handle("/api-keys", guard("api_keys.manage", controllers.CreateAPIKey)).Methods("POST")
+	account.Handle("/api-keys", guard("api_keys.manage", controllers.RevokeAPIKey)).Methods("DELETE")
+
+	account.Handle("/auth/lockouts", guard("view_users", controllers.GetLockouts)).Methods("GET")
+	account.Handle("/auth/lockouts", guard("edit_users", controllers.ClearLockout)).Methods("DELETE")
+	account.Handle("/auth/login-attempts", guard("view_users", controllers.GetLoginAttempts)).Methods("GET")
+	account.Handle("/auth/keys/rotate", guard("signing_keys.rotate", controllers.RotateSigningKey)).Methods("POST")
+
+	account.Handle("/audit", guard("audit.view", controllers.GetAuditLogs)).Methods("GET")
+	account.Handle("/audit/export", guard("audit.view", controllers.ExportAuditLogs)).Methods("GET")
+
+	account.Handle("/webhooks", guard("webhooks.manage", controllers.GetWebhooks)).Methods("GET")
+	account.Handle("/webhooks", guard("webhooks.manage", controllers.CreateWebhook)).Methods("POST")
+	account.Handle("/webhooks", guard("webhooks.manage", controllers.UpdateWebhook)).Methods("PUT")
+	account.Handle("/webhooks", guard("webhooks.manage", controllers.DeleteWebhook)).Methods("DELETE")
+	account.Handle("/webhooks/events", guard("webhooks.manage", controllers.GetWebhookEvents)).Methods("GET")
+	account.Handle("/webhooks/test", guard("webhooks.manage", controllers.TestWebhook)).Methods("POST")
+	account.Handle("/webhooks/deliveries", guard("webhooks.manage", controllers.GetWebhookDeliveries)).Methods("GET")
+	account.Handle("/webhooks/deliveries/getbyid", guard("webhooks.manage", controllers.GetWebhookDeliveryByID)).Methods("GET")
+	account.Handle("/webhooks/deliveries/redeliver", guard("webhooks.manage", controllers.RedeliverWebhook)).Methods("POST")
 
 	return r
 }
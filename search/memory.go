@@ -0,0 +1,261 @@
+package search
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// titleBoost counts each title term as this many body occurrences
+	titleBoost = 3
+)
+
+type memoryDoc struct {
+	Document
+	title, body string // plain text used for snippets
+	length      int    // weighted term count
+}
+
+// MemoryIndex is an in-process inverted index ranked with BM25. It is safe
+// for concurrent use.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]*memoryDoc
+	postings map[string]map[string]int // term -> doc key -> weighted frequency
+	totalLen int
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[string]*memoryDoc),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+func (m *MemoryIndex) Replace(docType string, id uint, docs []Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(docType, id)
+	for _, d := range docs {
+		d.Type, d.ID = docType, id
+		m.add(d)
+	}
+	return nil
+}
+
+func (m *MemoryIndex) Delete(docType string, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(docType, id)
+	return nil
+}
+
+func (m *MemoryIndex) add(d Document) {
+	doc := &memoryDoc{Document: d, title: StripHTML(d.Title), body: StripHTML(d.Body)}
+	key := d.key()
+
+	freq := make(map[string]int)
+	for _, t := range Tokenize(doc.title) {
+		freq[t] += titleBoost
+		doc.length += titleBoost
+	}
+	for _, t := range Tokenize(doc.body) {
+		freq[t]++
+		doc.length++
+	}
+	for t, n := range freq {
+		if m.postings[t] == nil {
+			m.postings[t] = make(map[string]int)
+		}
+		m.postings[t][key] = n
+	}
+	m.docs[key] = doc
+	m.totalLen += doc.length
+}
+
+func (m *MemoryIndex) remove(docType string, id uint) {
+	prefix := docType + ":" + uintString(id) + ":"
+	for key, doc := range m.docs {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for _, t := range Tokenize(doc.title + " " + doc.body) {
+			if p := m.postings[t]; p != nil {
+				delete(p, key)
+				if len(p) == 0 {
+					delete(m.postings, t)
+				}
+			}
+		}
+		m.totalLen -= doc.length
+		delete(m.docs, key)
+	}
+}
+
+// queryTerms tokenizes the query. The last spaced-script word also matches
+// as a prefix so results update while the user is still typing.
+func (m *MemoryIndex) queryTerms(text string) (terms []string, prefix string) {
+	terms = Tokenize(text)
+	ws := words(text)
+	if len(ws) > 0 {
+		if last := ws[len(ws)-1]; !unspaced(last[0]) && len(last) >= 2 {
+			prefix = string(last)
+		}
+	}
+	return terms, prefix
+}
+
+func (q *Query) matches(d *memoryDoc) bool {
+	if len(q.Types) > 0 && !slices.Contains(q.Types, d.Type) {
+		return false
+	}
+	if q.Category != "" && !strings.EqualFold(q.Category, d.Category) {
+		return false
+	}
+	if !q.From.IsZero() && d.Date.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !d.Date.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+func (m *MemoryIndex) Search(q Query) (Result, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms, prefix := m.queryTerms(q.Text)
+	if len(terms) == 0 || len(m.docs) == 0 {
+		return Result{Hits: []Hit{}}, nil
+	}
+
+	// Expand the prefix to indexed terms, scoring them as one extra term
+	expanded := map[string]bool{}
+	if prefix != "" {
+		for t := range m.postings {
+			if t != prefix && strings.HasPrefix(t, prefix) {
+				expanded[t] = true
+			}
+		}
+	}
+
+	n := float64(len(m.docs))
+	avgLen := float64(m.totalLen) / n
+	scores := make(map[string]float64)
+	matched := make(map[string]int)
+
+	score := func(term string, weight float64) {
+		p := m.postings[term]
+		if len(p) == 0 {
+			return
+		}
+		idf := math.Log(1 + (n-float64(len(p))+0.5)/(float64(len(p))+0.5))
+		for key, tf := range p {
+			doc := m.docs[key]
+			if !q.matches(doc) {
+				continue
+			}
+			f := float64(tf)
+			norm := f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLen))
+			scores[key] += weight * idf * norm
+		}
+	}
+
+	unique := slices.Compact(slices.Sorted(slices.Values(terms)))
+	for _, t := range unique {
+		score(t, 1)
+		for key := range m.postings[t] {
+			if _, ok := scores[key]; ok {
+				matched[key]++
+			}
+		}
+	}
+
+	// A document with only a longer form of the prefix word still counts as
+	// matching that word
+	hasPrefix := make(map[string]bool)
+	for t := range expanded {
+		score(t, 0.5)
+		for key := range m.postings[t] {
+			if _, ok := scores[key]; ok {
+				if _, exact := m.postings[prefix][key]; !exact && !hasPrefix[key] {
+					hasPrefix[key] = true
+					matched[key]++
+				}
+			}
+		}
+	}
+
+	// Documents containing every term rank above partial matches
+	for key := range scores {
+		if matched[key] >= len(unique) {
+			scores[key] *= 2
+		}
+	}
+
+	// Keep the best locale of each item, preferring the requested one
+	best := make(map[string]string)
+	for key, s := range scores {
+		doc := m.docs[key]
+		if doc.Locale == q.Locale && q.Locale != "" {
+			s *= 1.25
+			scores[key] = s
+		}
+		item := doc.Type + ":" + uintString(doc.ID)
+		if cur, ok := best[item]; !ok || s > scores[cur] || (s == scores[cur] && key < cur) {
+			best[item] = key
+		}
+	}
+
+	keys := make([]string, 0, len(best))
+	for _, key := range best {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if scores[a] != scores[b] {
+			if scores[a] > scores[b] {
+				return -1
+			}
+			return 1
+		}
+		if da, db := m.docs[a].Date, m.docs[b].Date; !da.Equal(db) {
+			return db.Compare(da)
+		}
+		return strings.Compare(a, b)
+	})
+
+	result := Result{Total: len(keys), Hits: []Hit{}}
+	if q.Offset >= len(keys) {
+		return result, nil
+	}
+	keys = keys[q.Offset:]
+	if q.Limit > 0 && len(keys) > q.Limit {
+		keys = keys[:q.Limit]
+	}
+
+	marks := needles(q.Text)
+	for _, key := range keys {
+		doc := m.docs[key]
+		result.Hits = append(result.Hits, Hit{
+			Type:     doc.Type,
+			ID:       doc.ID,
+			Locale:   doc.Locale,
+			Title:    Highlight(doc.title, marks),
+			Snippet:  Snippet(doc.body, marks, snippetWidth),
+			Category: doc.Category,
+			Date:     doc.Date,
+			Score:    math.Round(scores[key]*1000) / 1000,
+		})
+	}
+	return result, nil
+}
+
+// snippetWidth is the approximate snippet length in characters
+const snippetWidth = 160
@@ -0,0 +1,65 @@
+// Package search provides full-text search over published content. Content
+// is fed to an Indexer on every mutation; MemoryIndex is an embedded,
+// pure-Go implementation so no external search service is needed.
+package search
+
+import (
+	"time"
+)
+
+// Document is one searchable item in one locale
+type Document struct {
+	Type     string // news, highlights
+	ID       uint
+	Locale   string
+	Title    string
+	Body     string // may contain HTML; it is stripped before indexing
+	Category string
+	Date     time.Time
+}
+
+func (d Document) key() string {
+	return d.Type + ":" + uintString(d.ID) + ":" + d.Locale
+}
+
+// Query describes a search. Zero values disable a filter.
+type Query struct {
+	Text     string
+	Types    []string
+	Category string
+	Locale   string // prefer matches in this locale
+	From, To time.Time
+	Limit    int
+	Offset   int
+}
+
+// Hit is one matching item. Title and Snippet are HTML-escaped with matches
+// wrapped in <mark>.
+type Hit struct {
+	Type     string    `json:"type"`
+	ID       uint      `json:"id"`
+	Locale   string    `json:"locale"`
+	Title    string    `json:"title"`
+	Snippet  string    `json:"snippet"`
+	Category string    `json:"category,omitempty"`
+	Date     time.Time `json:"date"`
+	Score    float64   `json:"score"`
+}
+
+// Result is a page of hits and the total number of matching items
+type Result struct {
+	Hits  []Hit `json:"hits"`
+	Total int   `json:"total"`
+}
+
+// Indexer stores documents and answers queries
+type Indexer interface {
+	// Replace indexes docs as the full set of locales for (type, id)
+	Replace(docType string, id uint, docs []Document) error
+	// Delete removes every locale of (type, id)
+	Delete(docType string, id uint) error
+	Search(q Query) (Result, error)
+}
+
+// Default is the indexer used by the application
+var Default Indexer = NewMemoryIndex()
@@ -0,0 +1,137 @@
+package search
+
+import (
+	"errors"
+	"log/slog"
+
+	"wwb99/config"
+	"wwb99/i18n"
+	"wwb99/models"
+
+	"gorm.io/gorm"
+)
+
+// Types lists the searchable resource types
+var Types = []string{"news", "highlights"}
+
+// Searchable reports whether resourceType is indexed
+func Searchable(resourceType string) bool {
+	for _, t := range Types {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+func newsDocument(n models.News, locale string) Document {
+	return Document{Locale: locale, Title: n.Title, Body: n.Detail + "\n" + n.Content, Category: n.Category, Date: n.CreatedAt}
+}
+
+func highlightDocument(h models.Highlights, locale string) Document {
+	return Document{Locale: locale, Title: h.Title, Body: h.Content, Date: h.CreatedAt}
+}
+
+// documents builds one document for the default locale and one per
+// translation, with missing translated fields falling back to the original
+func documents[T any, PT interface {
+	*T
+	models.Translatable
+}](item T, translations []models.Translation, build func(T, string) Document) []Document {
+	docs := []Document{build(item, i18n.Default())}
+	for i := range translations {
+		localized := item
+		PT(&localized).ApplyTranslation(&translations[i])
+		docs = append(docs, build(localized, translations[i].Locale))
+	}
+	return docs
+}
+
+func translationsFor(resourceType string, id uint) ([]models.Translation, error) {
+	var translations []models.Translation
+	err := config.DB.Where("resource_type = ? AND resource_id = ? AND locale <> ?", resourceType, id, i18n.Default()).
+		Find(&translations).Error
+	return translations, err
+}
+
+// Sync reloads one item and its translations from the database into the
+// Default index, removing it if it no longer exists. Failures are logged:
+// the write that triggered the sync has already succeeded. On a database
+// error the existing entry is kept rather than dropped.
+func Sync(resourceType string, id uint) {
+	if !Searchable(resourceType) {
+		return
+	}
+
+	var docs []Document
+	var err error
+	switch resourceType {
+	case "news":
+		var n models.News
+		if err = config.DB.First(&n, id).Error; err == nil {
+			var translations []models.Translation
+			if translations, err = translationsFor("news", id); err == nil {
+				docs = documents(n, translations, newsDocument)
+			}
+		}
+	case "highlights":
+		var h models.Highlights
+		if err = config.DB.First(&h, id).Error; err == nil {
+			var translations []models.Translation
+			if translations, err = translationsFor("highlights", id); err == nil {
+				docs = documents(h, translations, highlightDocument)
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = Default.Delete(resourceType, id)
+	case err != nil:
+		slog.Error("Failed to load content for indexing", "resource_type", resourceType, "resource_id", id, "error", err)
+		return
+	default:
+		err = Default.Replace(resourceType, id, docs)
+	}
+	if err != nil {
+		slog.Error("Failed to index content", "resource_type", resourceType, "resource_id", id, "error", err)
+	}
+}
+
+// Rebuild indexes all searchable content. It is run once at startup.
+func Rebuild() error {
+	var translations []models.Translation
+	if err := config.DB.Where("resource_type IN ? AND locale <> ?", Types, i18n.Default()).Find(&translations).Error; err != nil {
+		return err
+	}
+	byItem := make(map[string][]models.Translation)
+	for _, t := range translations {
+		key := t.ResourceType + ":" + uintString(t.ResourceID)
+		byItem[key] = append(byItem[key], t)
+	}
+
+	var news []models.News
+	if err := config.DB.Find(&news).Error; err != nil {
+		return err
+	}
+	for _, n := range news {
+		id := uint(n.ID)
+		if err := Default.Replace("news", id, documents(n, byItem["news:"+uintString(id)], newsDocument)); err != nil {
+			return err
+		}
+	}
+
+	var highlights []models.Highlights
+	if err := config.DB.Find(&highlights).Error; err != nil {
+		return err
+	}
+	for _, h := range highlights {
+		id := uint(h.ID)
+		if err := Default.Replace("highlights", id, documents(h, byItem["highlights:"+uintString(id)], highlightDocument)); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Built search index", "news", len(news), "highlights", len(highlights))
+	return nil
+}
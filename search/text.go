@@ -0,0 +1,192 @@
+package search
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func uintString(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+// StripHTML returns the text content of an HTML fragment
+func StripHTML(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b.WriteByte(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(b.String())), " ")
+}
+
+// unspaced reports whether r belongs to a script written without spaces
+// between words, which is tokenized into character bigrams
+func unspaced(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Khmer, unicode.Thai, unicode.Lao, unicode.Myanmar)
+}
+
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// words splits text into lowercase runs of word characters. Runs of
+// unspaced scripts are kept separate from Latin runs.
+func words(text string) [][]rune {
+	var out [][]rune
+	var cur []rune
+	curUnspaced := false
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, cur)
+			cur = nil
+		}
+	}
+	for _, r := range text {
+		if !wordRune(r) {
+			flush()
+			continue
+		}
+		u := unspaced(r) || (unicode.IsMark(r) && curUnspaced)
+		if len(cur) > 0 && u != curUnspaced {
+			flush()
+		}
+		curUnspaced = u
+		cur = append(cur, unicode.ToLower(r))
+	}
+	flush()
+	return out
+}
+
+// Tokenize turns text into index terms: whole words for spaced scripts and
+// overlapping character bigrams for unspaced ones
+func Tokenize(text string) []string {
+	var terms []string
+	for _, w := range words(text) {
+		if !unspaced(w[0]) {
+			terms = append(terms, string(w))
+			continue
+		}
+		if len(w) == 1 {
+			terms = append(terms, string(w))
+			continue
+		}
+		for i := 0; i+1 < len(w); i++ {
+			terms = append(terms, string(w[i:i+2]))
+		}
+	}
+	return terms
+}
+
+// lowerRunes lowercases rune by rune so indexes line up with the original
+func lowerRunes(rs []rune) []rune {
+	out := make([]rune, len(rs))
+	for i, r := range rs {
+		out[i] = unicode.ToLower(r)
+	}
+	return out
+}
+
+type span struct{ start, end int }
+
+// findMatches returns the non-overlapping rune spans of text matching any
+// of the needles, case-insensitively
+func findMatches(text []rune, needles [][]rune) []span {
+	lower := lowerRunes(text)
+	var spans []span
+	for i := 0; i < len(lower); {
+		matched := 0
+		for _, n := range needles {
+			if len(n) > matched && i+len(n) <= len(lower) && equalRunes(lower[i:i+len(n)], n) {
+				matched = len(n)
+			}
+		}
+		if matched > 0 {
+			spans = append(spans, span{i, i + matched})
+			i += matched
+			continue
+		}
+		i++
+	}
+	return spans
+}
+
+func equalRunes(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// markup escapes text[from:to] and wraps the spans inside it in <mark>
+func markup(text []rune, spans []span, from, to int) string {
+	var b strings.Builder
+	pos := from
+	for _, s := range spans {
+		if s.end <= from || s.start >= to {
+			continue
+		}
+		start, end := max(s.start, from), min(s.end, to)
+		b.WriteString(html.EscapeString(string(text[pos:start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(text[start:end])))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(string(text[pos:to])))
+	return b.String()
+}
+
+// Highlight escapes text and marks every needle in it
+func Highlight(text string, needles [][]rune) string {
+	rs := []rune(text)
+	return markup(rs, findMatches(rs, needles), 0, len(rs))
+}
+
+// Snippet returns about width runes of text around the first match, escaped
+// and with matches marked. Without a match it returns the opening text.
+func Snippet(text string, needles [][]rune, width int) string {
+	rs := []rune(text)
+	spans := findMatches(rs, needles)
+
+	from := 0
+	if len(spans) > 0 {
+		from = max(0, spans[0].start-width/3)
+	}
+	to := min(len(rs), from+width)
+	if to == len(rs) {
+		from = max(0, to-width)
+	}
+
+	// Don't start or end mid-word in spaced scripts
+	if from > 0 {
+		if i := strings.IndexRune(string(rs[from:min(from+20, to)]), ' '); i >= 0 && !unspaced(rs[from]) {
+			from += len([]rune(string(rs[from:min(from+20, to)])[:i])) + 1
+		}
+	}
+
+	s := markup(rs, spans, from, to)
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(rs) {
+		s += "…"
+	}
+	return s
+}
+
+// needles are the raw query words used for highlighting
+func needles(text string) [][]rune {
+	return words(text)
+}
@@ -0,0 +1,122 @@
+package security
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+)
+
+const apiKeyPrefix = "wwb99"
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// GenerateAPIKey returns a new key of the form wwb99_<id>_<secret>, together
+// with its lookup prefix (wwb99_<id>) and the hash to store
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	id, err := GenerateToken(6)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// base64url may contain '_', which is our separator
+	id = strings.ReplaceAll(id, "_", "-")
+	prefix = apiKeyPrefix + "_" + id
+	key = prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+func splitAPIKey(key string) (prefix string, ok bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return "", false
+	}
+	return parts[0] + "_" + parts[1], true
+}
+
+// ParseAllowedIPs normalises a list of IPs/CIDRs, rejecting invalid entries
+func ParseAllowedIPs(entries []string) (string, error) {
+	var cleaned []string
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if strings.Contains(e, "/") {
+			if _, _, err := net.ParseCIDR(e); err != nil {
+				return "", errors.New("invalid CIDR: " + e)
+			}
+		} else if net.ParseIP(e) == nil {
+			return "", errors.New("invalid IP: " + e)
+		}
+		cleaned = append(cleaned, e)
+	}
+	return strings.Join(cleaned, ","), nil
+}
+
+// IPAllowed reports whether ip matches a comma separated list of IPs and
+// CIDRs. An empty list allows every address.
+func IPAllowed(allowed, ip string) bool {
+	if allowed == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, e := range strings.Split(allowed, ",") {
+		if strings.Contains(e, "/") {
+			if _, network, err := net.ParseCIDR(e); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(e); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateAPIKey verifies key for a request from ip and records its use
+func AuthenticateAPIKey(key, ip string) (*models.APIKey, error) {
+	prefix, ok := splitAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	if err := config.DB.Preload("Permissions").Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashToken(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+	if !IPAllowed(apiKey.AllowedIPs, ip) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Only write last-used info once a minute to keep hot keys cheap
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute || apiKey.LastUsedIP != ip {
+		config.DB.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		})
+		apiKey.LastUsedAt = &now
+		apiKey.LastUsedIP = ip
+	}
+
+	return &apiKey, nil
+}
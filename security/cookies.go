@@ -0,0 +1,92 @@
+package security
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// RefreshCookieName holds the refresh token when REFRESH_TOKEN_COOKIE=true
+	RefreshCookieName = "refresh_token"
+	// CSRFCookieName holds the double-submit token; it is readable by
+	// JavaScript so the frontend can echo it in CSRFHeader
+	CSRFCookieName = "csrf_token"
+	CSRFHeader     = "X-CSRF-Token"
+
+	// refreshCookiePath limits the refresh cookie to the endpoint that uses it
+	refreshCookiePath = "/api/refresh"
+)
+
+// RefreshCookieEnabled reports whether refresh tokens are issued as an
+// HttpOnly cookie instead of a JSON field
+func RefreshCookieEnabled() bool {
+	return envBool("REFRESH_TOKEN_COOKIE", false)
+}
+
+// cookieSameSite reads REFRESH_COOKIE_SAMESITE (strict, lax or none)
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(os.Getenv("REFRESH_COOKIE_SAMESITE")) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+func cookieSecure() bool {
+	// SameSite=None is only accepted by browsers on Secure cookies
+	return envBool("REFRESH_COOKIE_SECURE", true) || cookieSameSite() == http.SameSiteNoneMode
+}
+
+// SetRefreshCookie stores the refresh token in an HttpOnly cookie and issues
+// a matching CSRF token. It returns the CSRF token.
+func SetRefreshCookie(w http.ResponseWriter, refreshToken string) (string, error) {
+	csrf, err := GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	maxAge := int(SessionTTL.Seconds())
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		Domain:   os.Getenv("REFRESH_COOKIE_DOMAIN"),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   cookieSecure(),
+		SameSite: cookieSameSite(),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    csrf,
+		Path:     "/",
+		Domain:   os.Getenv("REFRESH_COOKIE_DOMAIN"),
+		MaxAge:   maxAge,
+		Secure:   cookieSecure(),
+		SameSite: cookieSameSite(),
+	})
+	return csrf, nil
+}
+
+// ClearRefreshCookie expires the refresh and CSRF cookies
+func ClearRefreshCookie(w http.ResponseWriter) {
+	for _, c := range []struct{ name, path string }{
+		{RefreshCookieName, refreshCookiePath},
+		{CSRFCookieName, "/"},
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.name,
+			Value:    "",
+			Path:     c.path,
+			Domain:   os.Getenv("REFRESH_COOKIE_DOMAIN"),
+			MaxAge:   -1,
+			HttpOnly: c.name == RefreshCookieName,
+			Secure:   cookieSecure(),
+			SameSite: cookieSameSite(),
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package security
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginPolicy controls login throttling. Each failed attempt doubles the delay
+// before the next attempt is accepted (BackoffBase, 2x, 4x ... up to
+// MaxBackoff); once MaxUserFailures / MaxIPFailures is reached the key is
+// locked for LockoutDuration.
+type LoginPolicy struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	LockoutDuration time.Duration
+	BackoffBase     time.Duration
+	MaxBackoff      time.Duration
+}
+
+var (
+	policyOnce sync.Once
+	policy     LoginPolicy
+)
+
+// GetLoginPolicy reads the policy from the environment once
+func GetLoginPolicy() LoginPolicy {
+	policyOnce.Do(func() {
+		policy = LoginPolicy{
+			MaxUserFailures: envInt("LOGIN_MAX_USER_FAILURES", 5),
+			MaxIPFailures:   envInt("LOGIN_MAX_IP_FAILURES", 20),
+			LockoutDuration: time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+			BackoffBase:     time.Duration(envInt("LOGIN_BACKOFF_BASE_MS", 1000)) * time.Millisecond,
+			MaxBackoff:      time.Duration(envInt("LOGIN_MAX_BACKOFF_SECONDS", 60)) * time.Second,
+		}
+	})
+	return policy
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func UserKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginBlockedError is returned when a login must be rejected before the
+// password is checked
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, account temporarily locked"
+	}
+	return "too many login attempts, slow down"
+}
+
+// retryAfter returns how long the caller must wait before key may try again
+func (p LoginPolicy) retryAfter(t models.LoginThrottle, now time.Time) (time.Duration, bool) {
+	if t.LockedUntil != nil && t.LockedUntil.After(now) {
+		return t.LockedUntil.Sub(now), true
+	}
+	if t.Failures == 0 {
+		return 0, false
+	}
+
+	backoff := p.BackoffBase
+	for i := 1; i < t.Failures && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if next := t.LastFailureAt.Add(backoff); next.After(now) {
+		return next.Sub(now), false
+	}
+	return 0, false
+}
+
+// LoginReservation is an attempt already counted against the throttle by
+// ReserveLogin. A failed attempt needs nothing more; a successful one must
+// Release it.
+type LoginReservation struct {
+	keys []reservedKey
+}
+
+type reservedKey struct {
+	key      string
+	max      int
+	prevLast time.Time
+	locked   bool // this attempt is the one that locked the key
+}
+
+// ReserveLogin decides whether an attempt from ip for username may proceed
+// and, if so, counts it as a failure before the password is checked. Both
+// happen under a row lock, so parallel guesses see each other's attempts
+// and can't slip past the backoff or lockout.
+func ReserveLogin(ip, username string) (*LoginReservation, error) {
+	p := GetLoginPolicy()
+	res := &LoginReservation{keys: []reservedKey{{key: IPKey(ip), max: p.MaxIPFailures}}}
+	if strings.TrimSpace(username) != "" {
+		res.keys = append(res.keys, reservedKey{key: UserKey(username), max: p.MaxUserFailures})
+	}
+	names := res.keyNames()
+
+	// The rows must exist for the lock below to serialise attempts
+	now := time.Now()
+	rows := make([]models.LoginThrottle, len(names))
+	for i, name := range names {
+		rows[i] = models.LoginThrottle{Key: name, LastFailureAt: now}
+	}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Lock in key order so two attempts can't deadlock each other
+		var throttles []models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("`key` IN ?", names).Order("`key`").Find(&throttles).Error
+		if err != nil {
+			return err
+		}
+
+		var blocked *LoginBlockedError
+		for _, t := range throttles {
+			wait, locked := p.retryAfter(t, now)
+			if wait <= 0 {
+				continue
+			}
+			if blocked == nil || wait > blocked.RetryAfter {
+				blocked = &LoginBlockedError{RetryAfter: wait, Locked: locked}
+			}
+		}
+		if blocked != nil {
+			return blocked
+		}
+
+		for _, t := range throttles {
+			k := res.key(t.Key)
+			if k == nil {
+				continue
+			}
+			k.prevLast = t.LastFailureAt
+
+			// An expired lockout starts a fresh window
+			if t.LockedUntil != nil && !t.LockedUntil.After(now) {
+				t.Failures = 0
+				t.LockedUntil = nil
+			}
+
+			t.Failures++
+			t.LastFailureAt = now
+			if t.Failures >= k.max {
+				until := now.Add(p.LockoutDuration)
+				t.LockedUntil = &until
+				k.locked = true
+			}
+			if err := tx.Save(&t).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Release takes back the failure ReserveLogin counted, once the password
+// or second factor turned out to be right
+func (res *LoginReservation) Release() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var throttles []models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("`key` IN ?", res.keyNames()).Order("`key`").Find(&throttles).Error
+		if err != nil {
+			return err
+		}
+
+		for _, t := range throttles {
+			k := res.key(t.Key)
+			if k == nil {
+				continue
+			}
+			if t.Failures > 0 {
+				t.Failures--
+			}
+			t.LastFailureAt = k.prevLast
+			if k.locked && t.Failures < k.max {
+				t.LockedUntil = nil
+			}
+			if err := tx.Save(&t).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (res *LoginReservation) keyNames() []string {
+	names := make([]string, len(res.keys))
+	for i, k := range res.keys {
+		names[i] = k.key
+	}
+	return names
+}
+
+func (res *LoginReservation) key(name string) *reservedKey {
+	for i := range res.keys {
+		if res.keys[i].key == name {
+			return &res.keys[i]
+		}
+	}
+	return nil
+}
+
+// RecordLoginSuccess clears the failure counter for username. The per-IP
+// counter is left to expire, otherwise an attacker could reset it by
+// logging into their own account between guesses at others.
+func RecordLoginSuccess(username string) error {
+	return ClearLockout(UserKey(username))
+}
+
+// ClearLockout removes throttle state for the given keys
+func ClearLockout(keys ...string) error {
+	return config.DB.Where("`key` IN ?", keys).Delete(&models.LoginThrottle{}).Error
+}
+
+// LogLoginAttempt appends an entry to the login audit trail
+func LogLoginAttempt(username, ip, userAgent string, success bool, reason string) error {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	return config.DB.Create(&models.LoginAttempt{
+		Username:  username,
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   success,
+		Reason:    reason,
+	}).Error
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// CompareDummyPassword spends the same bcrypt work as a real comparison so
+// unknown usernames can't be told apart by response time
+func CompareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
@@ -0,0 +1,120 @@
+package security
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// memoryDB points config.DB at an empty in-memory database with the given
+// models migrated
+func memoryDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // every connection would get its own memory database
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+
+	old := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = old
+		sqlDB.Close()
+	})
+}
+
+// setLoginPolicy replaces the environment policy for one test
+func setLoginPolicy(t *testing.T, p LoginPolicy) {
+	t.Helper()
+	old := GetLoginPolicy()
+	policy = p
+	t.Cleanup(func() { policy = old })
+}
+
+func TestReserveLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  LoginPolicy
+		release []bool // whether each attempt turned out right
+		blocked bool   // whether one more attempt is refused
+		locked  bool
+	}{
+		{"first attempt", LoginPolicy{5, 20, time.Minute, time.Hour, time.Hour}, nil, false, false},
+		{"backoff after a failure", LoginPolicy{5, 20, time.Minute, time.Hour, time.Hour}, []bool{false}, true, false},
+		{"released attempt", LoginPolicy{5, 20, time.Minute, time.Hour, time.Hour}, []bool{true}, false, false},
+		{"lockout at the limit", LoginPolicy{3, 20, time.Minute, time.Nanosecond, time.Nanosecond}, []bool{false, false, false}, true, true},
+		{"ip lockout", LoginPolicy{5, 2, time.Minute, time.Nanosecond, time.Nanosecond}, []bool{false, false}, true, true},
+		{"right password at the limit", LoginPolicy{3, 20, time.Minute, time.Nanosecond, time.Nanosecond}, []bool{false, false, true}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memoryDB(t, &models.LoginThrottle{})
+			setLoginPolicy(t, tt.policy)
+
+			for i, ok := range tt.release {
+				attempt, err := ReserveLogin("10.0.0.1", "alice")
+				if err != nil {
+					t.Fatalf("attempt %d: %v", i+1, err)
+				}
+				if ok {
+					if err := attempt.Release(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			_, err := ReserveLogin("10.0.0.1", "Alice")
+			var blocked *LoginBlockedError
+			if errors.As(err, &blocked) != tt.blocked {
+				t.Fatalf("err = %v, want blocked %v", err, tt.blocked)
+			}
+			if blocked != nil && blocked.Locked != tt.locked {
+				t.Fatalf("locked = %v, want %v", blocked.Locked, tt.locked)
+			}
+		})
+	}
+}
+
+func TestReserveLoginParallel(t *testing.T) {
+	memoryDB(t, &models.LoginThrottle{})
+	setLoginPolicy(t, LoginPolicy{5, 20, time.Minute, time.Hour, time.Hour})
+
+	// Parallel guesses must see each other: only the first gets through
+	// before the backoff applies
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ReserveLogin("10.0.0.1", "alice")
+			var blocked *LoginBlockedError
+			if err != nil && !errors.As(err, &blocked) {
+				t.Error(err)
+			}
+			if err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 1 {
+		t.Fatalf("%d parallel attempts got through, want 1", allowed)
+	}
+}
@@ -0,0 +1,114 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PasswordPolicy describes the strength rules applied to new passwords
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUsername bool
+}
+
+var (
+	passwordPolicyOnce sync.Once
+	passwordPolicy     PasswordPolicy
+)
+
+// GetPasswordPolicy reads PASSWORD_* settings from the environment once.
+// MaxLength defaults to 72, the most bcrypt will hash.
+func GetPasswordPolicy() PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		passwordPolicy = PasswordPolicy{
+			MinLength:        envInt("PASSWORD_MIN_LENGTH", 8),
+			MaxLength:        envInt("PASSWORD_MAX_LENGTH", 72),
+			RequireUpper:     envBool("PASSWORD_REQUIRE_UPPER", true),
+			RequireLower:     envBool("PASSWORD_REQUIRE_LOWER", true),
+			RequireDigit:     envBool("PASSWORD_REQUIRE_DIGIT", true),
+			RequireSymbol:    envBool("PASSWORD_REQUIRE_SYMBOL", false),
+			DisallowUsername: envBool("PASSWORD_DISALLOW_USERNAME", true),
+		}
+	})
+	return passwordPolicy
+}
+
+func envBool(name string, def bool) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "true", "1", "yes":
+		return true
+	case "false", "0", "no":
+		return false
+	default:
+		return def
+	}
+}
+
+// PasswordPolicyError lists every rule a password failed
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+// Validate checks password against the policy
+func (p PasswordPolicy) Validate(password, username string) error {
+	var violations []string
+
+	if len(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+	if p.DisallowUsername && username != "" &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, "must not contain the username")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidatePassword checks password against the configured policy
+func ValidatePassword(password, username string) error {
+	return GetPasswordPolicy().Validate(password, username)
+}
@@ -0,0 +1,290 @@
+package security
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"gorm.io/gorm"
+)
+
+// maxRoleDepth bounds parent traversal so a corrupted hierarchy can't loop
+const maxRoleDepth = 16
+
+var ErrRoleCycle = errors.New("role hierarchy would contain a cycle")
+
+// Grant is one entry of a role's effective permission set
+type Grant struct {
+	Permission string `json:"permission"`
+	RoleID     uint   `json:"role_id"`
+	RoleName   string `json:"role_name"`
+	Inherited  bool   `json:"inherited"`
+}
+
+type rolePermissions struct {
+	version  uint
+	grants   []Grant
+	loadedAt time.Time
+}
+
+// permCache holds each role's effective (inherited) grants so authorization
+// doesn't hit the database on every request. Entries are dropped as soon as
+// this process changes a role's permissions; the TTL bounds staleness for
+// changes made by other instances.
+var permCache = struct {
+	sync.RWMutex
+	roles map[uint]*rolePermissions
+}{roles: map[uint]*rolePermissions{}}
+
+func permCacheTTL() time.Duration {
+	if s, err := strconv.Atoi(os.Getenv("PERMISSION_CACHE_TTL_SECONDS")); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// loadGrants walks from roleID up through its ancestors collecting grants
+func loadGrants(roleID uint) ([]Grant, uint, error) {
+	var grants []Grant
+	var version uint
+
+	seen := map[uint]bool{}
+	id := &roleID
+	for depth := 0; id != nil && depth < maxRoleDepth; depth++ {
+		if seen[*id] {
+			break
+		}
+		seen[*id] = true
+
+		var role models.Role
+		if err := config.DB.Preload("Permissions").First(&role, *id).Error; err != nil {
+			if depth == 0 {
+				return nil, 0, err
+			}
+			break
+		}
+		if depth == 0 {
+			version = role.PermissionVersion
+		}
+
+		for _, p := range role.Permissions {
+			grants = append(grants, Grant{
+				Permission: p.Name,
+				RoleID:     role.ID,
+				RoleName:   role.Name,
+				Inherited:  depth > 0,
+			})
+		}
+		id = role.ParentID
+	}
+	return grants, version, nil
+}
+
+func cachedGrants(roleID uint) ([]Grant, uint, error) {
+	permCache.RLock()
+	entry, ok := permCache.roles[roleID]
+	permCache.RUnlock()
+	if ok && time.Since(entry.loadedAt) < permCacheTTL() {
+		return entry.grants, entry.version, nil
+	}
+
+	grants, version, err := loadGrants(roleID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	permCache.Lock()
+	permCache.roles[roleID] = &rolePermissions{
+		version:  version,
+		grants:   grants,
+		loadedAt: time.Now(),
+	}
+	permCache.Unlock()
+
+	return grants, version, nil
+}
+
+// RolePermissions returns the names (possibly wildcards) granted to the role
+// directly or through its ancestors, and the role's current version
+func RolePermissions(roleID uint) (map[string]bool, uint, error) {
+	grants, version, err := cachedGrants(roleID)
+	if err != nil {
+		return nil, 0, err
+	}
+	names := make(map[string]bool, len(grants))
+	for _, g := range grants {
+		names[g.Permission] = true
+	}
+	return names, version, nil
+}
+
+// RoleHasPermission reports whether roleID grants the named permission,
+// honouring inheritance and wildcards
+func RoleHasPermission(roleID uint, name string) bool {
+	grants, _, err := cachedGrants(roleID)
+	if err != nil {
+		return false
+	}
+	for _, g := range grants {
+		if models.PermissionMatches(g.Permission, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectivePermissions expands the role's grants against all known
+// permissions. Each permission is listed once with the grant it comes from,
+// preferring an exact-name grant closest to the role over wildcard grants.
+func EffectivePermissions(roleID uint) ([]Grant, error) {
+	grants, _, err := cachedGrants(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []models.Permission
+	if err := config.DB.Find(&all).Error; err != nil {
+		return nil, err
+	}
+
+	// Grants are ordered from the role itself up to the root, so the first
+	// match is the closest one
+	effective := []Grant{}
+	for _, p := range all {
+		var best *Grant
+		for i, g := range grants {
+			if g.Permission == p.Name {
+				best = &grants[i]
+				break
+			}
+			if best == nil && models.PermissionMatches(g.Permission, p.Name) {
+				best = &grants[i]
+			}
+		}
+		if best != nil {
+			effective = append(effective, Grant{
+				Permission: p.Name,
+				RoleID:     best.RoleID,
+				RoleName:   best.RoleName,
+				Inherited:  best.Inherited,
+			})
+		}
+	}
+
+	sort.Slice(effective, func(i, j int) bool {
+		return effective[i].Permission < effective[j].Permission
+	})
+	return effective, nil
+}
+
+// PermissionNames flattens grants into a list of names
+func PermissionNames(grants []Grant) []string {
+	names := make([]string, 0, len(grants))
+	for _, g := range grants {
+		names = append(names, g.Permission)
+	}
+	return names
+}
+
+// descendantRoleIDs returns ids plus every role below them in the hierarchy
+func descendantRoleIDs(tx *gorm.DB, ids []uint) ([]uint, error) {
+	var roles []models.Role
+	if err := tx.Select("id", "parent_id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	children := map[uint][]uint{}
+	for _, r := range roles {
+		if r.ParentID != nil {
+			children[*r.ParentID] = append(children[*r.ParentID], r.ID)
+		}
+	}
+
+	seen := map[uint]bool{}
+	queue := append([]uint{}, ids...)
+	var result []uint
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+		queue = append(queue, children[id]...)
+	}
+	return result, nil
+}
+
+// ValidateRoleParent checks that making parentID the parent of roleID keeps
+// the hierarchy acyclic. roleID is 0 for a role being created.
+func ValidateRoleParent(tx *gorm.DB, roleID uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	var parent models.Role
+	if err := tx.First(&parent, *parentID).Error; err != nil {
+		return err
+	}
+	if roleID == 0 {
+		return nil
+	}
+
+	descendants, err := descendantRoleIDs(tx, []uint{roleID})
+	if err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == *parentID {
+			return ErrRoleCycle
+		}
+	}
+	return nil
+}
+
+// InvalidateRolePermissions bumps the permission version of the given roles
+// and all roles inheriting from them, and returns their IDs. Pass the
+// transaction the mapping change runs in so the bump commits with it, then
+// call EvictRolePermissions with the IDs once it has committed; evicting
+// earlier lets a concurrent request cache the old grants again.
+func InvalidateRolePermissions(tx *gorm.DB, roleIDs ...uint) ([]uint, error) {
+	ids, err := descendantRoleIDs(tx, roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		err := tx.Model(&models.Role{}).Where("id IN ?", ids).
+			UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// InvalidateRolesWithPermission invalidates every role granted permissionID
+func InvalidateRolesWithPermission(tx *gorm.DB, permissionID uint) ([]uint, error) {
+	var roleIDs []uint
+	if err := tx.Model(&models.RolePermission{}).
+		Where("permission_id = ?", permissionID).
+		Pluck("role_id", &roleIDs).Error; err != nil {
+		return nil, err
+	}
+	return InvalidateRolePermissions(tx, roleIDs...)
+}
+
+// EvictRolePermissions drops the given roles from the permission cache
+func EvictRolePermissions(roleIDs ...uint) {
+	permCache.Lock()
+	for _, id := range roleIDs {
+		delete(permCache.roles, id)
+	}
+	permCache.Unlock()
+}
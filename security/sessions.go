@@ -0,0 +1,133 @@
+package security
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+)
+
+// SessionTTL matches the refresh token lifetime; a session can't outlive the
+// refresh token issued for it
+const SessionTTL = 7 * 24 * time.Hour
+
+var ErrInvalidSession = errors.New("session revoked or expired")
+
+// CreateSession records a new login for userID and prunes the user's expired
+// sessions
+func CreateSession(userID uint, ip, userAgent string) (*models.Session, error) {
+	now := time.Now()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	session := models.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		Device:     DescribeUserAgent(userAgent),
+		IP:         ip,
+		LastSeenIP: ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	config.DB.Where("user_id = ? AND expires_at <= ?", userID, now).Delete(&models.Session{})
+	return &session, nil
+}
+
+// ValidateSession checks that the session belongs to userID and is still
+// active, updating last-seen info at most once a minute
+func ValidateSession(sessionID, userID uint, ip string) (*models.Session, error) {
+	var session models.Session
+	if err := config.DB.First(&session, sessionID).Error; err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	if session.UserID != userID || !session.Active(now) {
+		return nil, ErrInvalidSession
+	}
+
+	if now.Sub(session.LastSeenAt) > time.Minute || session.LastSeenIP != ip {
+		config.DB.Model(&models.Session{}).Where("id = ?", session.ID).UpdateColumns(map[string]interface{}{
+			"last_seen_at": now,
+			"last_seen_ip": ip,
+		})
+		session.LastSeenAt = now
+		session.LastSeenIP = ip
+	}
+	return &session, nil
+}
+
+// RevokeSession revokes one of userID's sessions. It returns false when no
+// active session matched.
+func RevokeSession(userID, sessionID uint) (bool, error) {
+	result := config.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUserSessions revokes all of userID's active sessions except those in
+// keep and returns how many were revoked
+func RevokeUserSessions(userID uint, keep ...uint) (int64, error) {
+	db := config.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now())
+	if len(keep) > 0 {
+		db = db.Where("id NOT IN ?", keep)
+	}
+	result := db.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// DescribeUserAgent turns a User-Agent header into a short label such as
+// "Firefox on Linux". It only needs to help a user recognise their devices.
+func DescribeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, p := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
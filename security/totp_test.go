@@ -0,0 +1,141 @@
+package security
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       int64
+		wantStep int64
+		wantOK   bool
+	}{
+		// Last six digits of the RFC 6238 appendix B vectors
+		{"rfc 59", rfcSecret, "287082", 59, 1, true},
+		{"rfc 1111111109", rfcSecret, "081804", 1111111109, 37037036, true},
+		{"rfc 1234567890", rfcSecret, "005924", 1234567890, 41152263, true},
+		{"rfc 2000000000", rfcSecret, "279037", 2000000000, 66666666, true},
+		{"one step late", rfcSecret, "005924", 1234567890 + 30, 41152263, true},
+		{"one step early", rfcSecret, "005924", 1234567890 - 30, 41152263, true},
+		{"two steps late", rfcSecret, "005924", 1234567890 + 60, 0, false},
+		{"spaces", rfcSecret, " 005 924 ", 1234567890, 41152263, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "005924", 1234567890, 41152263, true},
+		{"wrong code", rfcSecret, "005925", 1234567890, 0, false},
+		{"short code", rfcSecret, "05924", 1234567890, 0, false},
+		{"bad secret", "not base32!", "005924", 1234567890, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.at, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Fatalf("ValidateTOTP = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// codeAt returns the code for the given step offset from now
+func codeAt(t *testing.T, offset int64) string {
+	t.Helper()
+	key, err := b32.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotp(key, uint64(time.Now().Unix()/totpPeriod+offset))
+}
+
+func TestVerifySecondFactorReplay(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []int64 // step offsets from now, tried in order
+		want  []bool
+	}{
+		{"single use", []int64{0, 0}, []bool{true, false}},
+		{"later step", []int64{-1, 0}, []bool{true, true}},
+		{"earlier step after a later one", []int64{0, -1}, []bool{true, false}},
+		{"outside the window", []int64{3}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memoryDB(t, &models.User{})
+			user := models.User{Username: "alice", TOTPSecret: rfcSecret, TOTPEnabled: true}
+			if err := config.DB.Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			for i, offset := range tt.codes {
+				// A fresh copy each time, as a new request would load it
+				var u models.User
+				config.DB.First(&u, user.ID)
+				err := VerifySecondFactor(&u, codeAt(t, offset), "")
+				if (err == nil) != tt.want[i] {
+					t.Fatalf("code %d: err = %v, want accepted %v", i+1, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string // hash kept in the database
+		typed  []string
+		want   []bool
+	}{
+		{"as issued", HashRecoveryCode("abcde-fghij"), []string{"abcde-fghij"}, []bool{true}},
+		{"no dash", HashRecoveryCode("abcde-fghij"), []string{"abcdefghij"}, []bool{true}},
+		{"spaces and case", HashRecoveryCode("abcde-fghij"), []string{" ABCDE FGHIJ\t"}, []bool{true}},
+		{"single use", HashRecoveryCode("abcde-fghij"), []string{"abcde-fghij", "abcdefghij"}, []bool{true, false}},
+		{"legacy hash", hashCode("abcde-fghij"), []string{"ABCDEFGHIJ"}, []bool{true}},
+		{"wrong code", HashRecoveryCode("abcde-fghij"), []string{"abcde-fghik"}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memoryDB(t, &models.RecoveryCode{})
+			if err := config.DB.Create(&models.RecoveryCode{UserID: 1, CodeHash: tt.stored}).Error; err != nil {
+				t.Fatal(err)
+			}
+			for i, code := range tt.typed {
+				err := consumeRecoveryCode(1, code)
+				if (err == nil) != tt.want[i] {
+					t.Fatalf("%q: err = %v, want accepted %v", code, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsumeMFAToken(t *testing.T) {
+	memoryDB(t, &models.UsedMFAToken{})
+	exp := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name string
+		jti  string
+		want error
+	}{
+		{"first use", "a1", nil},
+		{"replay", "a1", ErrMFATokenUsed},
+		{"other token", "b2", nil},
+		{"no id", "", ErrMFATokenUsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ConsumeMFAToken(1, tt.jti, exp); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package security
+
+import (
+	"errors"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidSecondFactor = errors.New("invalid two-factor code")
+	ErrMFATokenUsed        = errors.New("login token already used")
+)
+
+// TwoFactorRequired reports whether user must pass a second factor to log in,
+// either because they enrolled or because their role enforces it
+func TwoFactorRequired(user *models.User) bool {
+	return user.TOTPEnabled || user.Role.Require2FA
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. TOTP codes are single-use: a step at or before the last accepted one
+// is rejected.
+func VerifySecondFactor(user *models.User, code, recoveryCode string) error {
+	if user.TOTPSecret == "" {
+		return ErrInvalidSecondFactor
+	}
+
+	if code != "" {
+		step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok || step <= user.TOTPLastUsedStep {
+			return ErrInvalidSecondFactor
+		}
+		// Conditional update so two concurrent logins can't both use the code
+		result := config.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_used_step < ?", user.ID, step).
+			Update("totp_last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidSecondFactor
+		}
+		user.TOTPLastUsedStep = step
+		return nil
+	}
+
+	if recoveryCode != "" && user.TOTPEnabled {
+		return consumeRecoveryCode(user.ID, recoveryCode)
+	}
+
+	return ErrInvalidSecondFactor
+}
+
+// ConsumeMFAToken marks the intermediate login token with id jti as used,
+// so it completes at most one login. It fails for a token without an id or
+// one that was already used.
+func ConsumeMFAToken(userID uint, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return ErrMFATokenUsed
+	}
+
+	// Expired tokens are refused anyway; keep the table small
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.UsedMFAToken{})
+
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UsedMFAToken{ID: jti, UserID: userID, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFATokenUsed
+	}
+	return nil
+}
+
+func consumeRecoveryCode(userID uint, code string) error {
+	result := config.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash IN ? AND used_at IS NULL", userID,
+			[]string{HashRecoveryCode(code), legacyRecoveryHash(code)}).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates all existing recovery codes for the user
+// and returns a new plaintext set, which is shown to the user only once
+func ReplaceRecoveryCodes(userID uint) ([]string, error) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, c := range codes {
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: HashRecoveryCode(c)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnableTwoFactor marks TOTP as active and issues recovery codes
+func EnableTwoFactor(user *models.User) ([]string, error) {
+	if err := config.DB.Model(user).Update("totp_enabled", true).Error; err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	return ReplaceRecoveryCodes(user.ID)
+}
+
+// DisableTwoFactor removes the TOTP secret and all recovery codes
+func DisableTwoFactor(user *models.User) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_enabled":        false,
+			"totp_last_used_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+}
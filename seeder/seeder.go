@@ -1,7 +1,7 @@
 package seeder
 
 import (
-	"log"
+	"log/slog"
 	"wwb99/config"
 	"wwb99/models"
 
@@ -12,7 +12,7 @@ func SeedRolesAndPermissions() {
 	db := config.DB
 
 	// 1. Create or get permissions
-	permNames := []string{"view_users", "edit_users", "delete_users", "view_roles", "edit_roles", "delete_roles", "view_permissions", "edit_permissions", "delete_permissions"}
+	permNames := []string{"view_users", "edit_users", "delete_users", "view_roles", "edit_roles", "delete_roles", "view_permissions", "edit_permissions", "delete_permissions", "audit.view", "api_keys.manage", "signing_keys.rotate", "webhooks.manage"}
 	var permissions []models.Permission
 
 	for _, name := range permNames {
@@ -24,17 +24,47 @@ func SeedRolesAndPermissions() {
 	// 2. Create or get roles
 	var adminRole models.Role
 	db.FirstOrCreate(&adminRole, models.Role{Name: "admin"})
+	db.Model(&adminRole).Update("require_2fa", true)
 
 	var userRole models.Role
 	db.FirstOrCreate(&userRole, models.Role{Name: "user"})
 
-	// 3. Attach permissions to adminRole
+	// 3. Content permissions: editors manage all content, authors only their own
+	content := func(names ...string) []models.Permission {
+		var perms []models.Permission
+		for _, name := range names {
+			var p models.Permission
+			db.FirstOrCreate(&p, models.Permission{Name: name})
+			perms = append(perms, p)
+		}
+		return perms
+	}
+	editorPerms := content("news.*", "highlights.*", "footers.*", "sponsors.*", "media.*")
+	authorPerms := content(
+		"news.create", "news.update.own", "news.delete.own",
+		"highlights.create", "highlights.update.own", "highlights.delete.own",
+	)
+
+	var authorRole models.Role
+	db.FirstOrCreate(&authorRole, models.Role{Name: "author"})
+	if err := db.Model(&authorRole).Association("Permissions").Replace(authorPerms); err != nil {
+		slog.Error("Error attaching author permissions", "error", err)
+	}
+
+	var editorRole models.Role
+	db.FirstOrCreate(&editorRole, models.Role{Name: "editor"})
+	if err := db.Model(&editorRole).Association("Permissions").Replace(editorPerms); err != nil {
+		slog.Error("Error attaching editor permissions", "error", err)
+	}
+
+	// 4. Attach permissions to adminRole; content rights are inherited from editor
 	err := db.Model(&adminRole).Association("Permissions").Replace(permissions)
 	if err != nil {
-		log.Printf("Error attaching permissions: %v", err)
+		slog.Error("Error attaching permissions", "error", err)
 	}
+	db.Model(&adminRole).Update("parent_id", editorRole.ID)
 
-	log.Println("✅ Seeded roles and permissions.")
+	slog.Info("Seeded roles and permissions")
 }
 func SeedOwnerUser() {
 	db := config.DB
@@ -42,6 +72,14 @@ func SeedOwnerUser() {
 	// 1. Create role "owner" if not exists
 	var ownerRole models.Role
 	db.FirstOrCreate(&ownerRole, models.Role{Name: "owner"})
+	db.Model(&ownerRole).Update("require_2fa", true)
+
+	// Owner is granted everything through the "*" wildcard
+	var all models.Permission
+	db.FirstOrCreate(&all, models.Permission{Name: "*"})
+	if err := db.Model(&ownerRole).Association("Permissions").Append(&all); err != nil {
+		slog.Error("Error granting owner permissions", "error", err)
+	}
 
 	// 2. Create user with that role
 	password, _ := bcrypt.GenerateFromPassword([]byte("owner123"), bcrypt.DefaultCost)
@@ -53,5 +91,5 @@ func SeedOwnerUser() {
 		RoleID:   ownerRole.ID,
 	})
 
-	log.Println("✅ Seeded owner user with role 'owner'")
+	slog.Info("Seeded owner user", "role", "owner")
 }
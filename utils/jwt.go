@@ -1,59 +1,138 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var (
-	accessSecret  = []byte(os.Getenv("JWT_SECRET"))         // Short-lived token
-	refreshSecret = []byte(os.Getenv("JWT_REFRESH_SECRET")) // Long-lived token
+// Token types, carried in the "token_use" claim so a token issued for one
+// purpose can never be accepted for another
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	TokenUseMFA     = "mfa"
 )
 
-// Generate access token (valid for 15 minutes)
-func GenerateAccessToken(userID uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+func issuer() string {
+	if iss := os.Getenv("JWT_ISSUER"); iss != "" {
+		return iss
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(accessSecret)
+	return "wwb99"
 }
 
-// Generate refresh token (valid for 7 days)
-func GenerateRefreshToken(userID uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+func audience() string {
+	if aud := os.Getenv("JWT_AUDIENCE"); aud != "" {
+		return aud
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(refreshSecret)
+	return "wwb99-api"
 }
 
-// Validate access token
-func ValidateAccessToken(tokenStr string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return accessSecret, nil
-	})
+// signToken signs claims with the active key ring key, adding the standard
+// iss/aud/iat/nbf/exp claims
+func signToken(claims jwt.MapClaims, use string, ttl time.Duration) (string, error) {
+	key, err := ring.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims["iss"] = issuer()
+	claims["aud"] = audience()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["token_use"] = use
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	} else {
+// parseToken verifies signature, algorithm, iss, aud, exp, nbf, iat and the
+// expected token_use
+func parseToken(tokenStr, use string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenStr, keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(issuer()),
+		jwt.WithAudience(audience()),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
 		return nil, err
 	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if claims["token_use"] != use {
+		return nil, errors.New("unexpected token type")
+	}
+	if _, ok := claims["user_id"].(float64); !ok {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// Generate access token (valid for 15 minutes). It carries the user's role
+// and that role's permission version so authorization can be served from the
+// in-process permission cache, and the session it belongs to.
+func GenerateAccessToken(userID, roleID, permVersion, sessionID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":      userID,
+		"role_id":      roleID,
+		"perm_version": permVersion,
+		"sid":          sessionID,
+	}
+	return signToken(claims, TokenUseAccess, 15*time.Minute)
+}
+
+// Generate refresh token (valid for 7 days) for a session
+func GenerateRefreshToken(userID, sessionID uint) (string, error) {
+	return signToken(jwt.MapClaims{"user_id": userID, "sid": sessionID}, TokenUseRefresh, 7*24*time.Hour)
+}
+
+// SessionID returns the "sid" claim, or 0 when the token has none
+func SessionID(claims jwt.MapClaims) uint {
+	sid, _ := claims["sid"].(float64)
+	return uint(sid)
+}
+
+// TokenID returns the "jti" claim, or "" when the token has none
+func TokenID(claims jwt.MapClaims) string {
+	jti, _ := claims["jti"].(string)
+	return jti
+}
+
+// Validate access token
+func ValidateAccessToken(tokenStr string) (jwt.MapClaims, error) {
+	return parseToken(tokenStr, TokenUseAccess)
 }
 
 // Validate refresh token
 func ValidateRefreshToken(tokenStr string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return refreshSecret, nil
-	})
+	return parseToken(tokenStr, TokenUseRefresh)
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	} else {
-		return nil, err
+// Generate intermediate token issued after a correct password when a second
+// factor is still required (valid for 5 minutes). Its random "jti" lets a
+// completed login mark the token used.
+func GenerateMFAToken(userID uint) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
 	}
+	return signToken(jwt.MapClaims{"user_id": userID, "jti": hex.EncodeToString(jti)}, TokenUseMFA, 5*time.Minute)
+}
+
+// Validate intermediate MFA token
+func ValidateMFAToken(tokenStr string) (jwt.MapClaims, error) {
+	return parseToken(tokenStr, TokenUseMFA)
 }
@@ -0,0 +1,402 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is a parsed models.SigningKey
+type signingKey struct {
+	kid       string
+	alg       string
+	private   crypto.Signer
+	createdAt time.Time
+	retiredAt *time.Time
+	expiresAt *time.Time
+}
+
+func (k *signingKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.alg)
+}
+
+// keyRing holds every key currently valid for verification and the active
+// signing key. It is shared across instances through the signing_keys table.
+type keyRing struct {
+	mu         sync.RWMutex
+	keys       map[string]*signingKey
+	active     *signingKey
+	lastReload time.Time
+}
+
+var ring = &keyRing{keys: map[string]*signingKey{}}
+
+func signingAlgorithm() string {
+	switch strings.ToUpper(os.Getenv("JWT_SIGNING_ALG")) {
+	case "RS256":
+		return jwt.SigningMethodRS256.Alg()
+	default:
+		return jwt.SigningMethodEdDSA.Alg()
+	}
+}
+
+func envDays(name string, def int) time.Duration {
+	if d, err := strconv.Atoi(os.Getenv(name)); err == nil && d > 0 {
+		return time.Duration(d) * 24 * time.Hour
+	}
+	return time.Duration(def) * 24 * time.Hour
+}
+
+// rotationPeriod is how long a key signs tokens before a new one takes over
+func rotationPeriod() time.Duration {
+	return envDays("JWT_KEY_ROTATION_DAYS", 30)
+}
+
+// verificationGrace is how long a retired key still verifies tokens. It must
+// exceed the refresh token lifetime.
+func verificationGrace() time.Duration {
+	return envDays("JWT_KEY_GRACE_DAYS", 8)
+}
+
+// sealedPrefix marks a private key encrypted with JWT_KEY_ENCRYPTION_KEY
+const sealedPrefix = "enc:v1:"
+
+// keyCipher returns the AEAD protecting stored private keys, or nil when
+// JWT_KEY_ENCRYPTION_KEY is unset. Without it keys are stored as plain PEM
+// and anyone able to read the signing_keys table can mint tokens.
+func keyCipher() (cipher.AEAD, error) {
+	secret := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if secret == "" {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPrivateKey encrypts a PEM private key for storage when a key
+// encryption key is configured
+func sealPrivateKey(pemKey []byte) (string, error) {
+	aead, err := keyCipher()
+	if err != nil || aead == nil {
+		return string(pemKey), err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, pemKey, []byte(sealedPrefix))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openPrivateKey returns the PEM of a stored private key
+func openPrivateKey(stored string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedPrefix)
+	if !ok {
+		return []byte(stored), nil
+	}
+	aead, err := keyCipher()
+	if err != nil {
+		return nil, err
+	}
+	if aead == nil {
+		return nil, errors.New("key is encrypted but JWT_KEY_ENCRYPTION_KEY is not set")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted key")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(sealedPrefix))
+}
+
+func generateSigningKey(alg string) (*models.SigningKey, error) {
+	var priv any
+	var err error
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	kidBytes := make([]byte, 12)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		Kid:        base64.RawURLEncoding.EncodeToString(kidBytes),
+		Algorithm:  alg,
+		PrivateKey: sealed,
+	}, nil
+}
+
+func parseSigningKey(m models.SigningKey) (*signingKey, error) {
+	pemKey, err := openPrivateKey(m.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return &signingKey{
+		kid:       m.Kid,
+		alg:       m.Algorithm,
+		private:   signer,
+		createdAt: m.CreatedAt,
+		retiredAt: m.RetiredAt,
+		expiresAt: m.ExpiresAt,
+	}, nil
+}
+
+// reload refreshes the in-memory ring from the database
+func (kr *keyRing) reload() error {
+	var rows []models.SigningKey
+	err := config.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC, id DESC").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*signingKey{}
+	var active *signingKey
+	for _, row := range rows {
+		k, err := parseSigningKey(row)
+		if err != nil {
+			slog.Error("Skipping unreadable signing key", "kid", row.Kid, "error", err)
+			continue
+		}
+		keys[k.kid] = k
+		if active == nil && k.retiredAt == nil {
+			active = k
+		}
+	}
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.active = active
+	kr.lastReload = time.Now()
+	kr.mu.Unlock()
+	return nil
+}
+
+// rotate creates a new signing key when forced, when there is none or when
+// the active one is older than the rotation period. Older keys are retired
+// and keys past their grace period are removed. When instances rotate at
+// the same time the key with the highest ID wins: each only retires keys
+// created before its own, so one active key always remains.
+func (kr *keyRing) rotate(force bool) error {
+	if err := kr.reload(); err != nil {
+		return err
+	}
+
+	kr.mu.RLock()
+	active := kr.active
+	kr.mu.RUnlock()
+
+	now := time.Now()
+	alg := signingAlgorithm()
+	if force || active == nil || now.Sub(active.createdAt) >= rotationPeriod() || active.alg != alg {
+		key, err := generateSigningKey(alg)
+		if err != nil {
+			return err
+		}
+		if err := config.DB.Create(key).Error; err != nil {
+			return err
+		}
+
+		err = config.DB.Model(&models.SigningKey{}).
+			Where("id < ? AND retired_at IS NULL", key.ID).
+			Updates(map[string]interface{}{"retired_at": now, "expires_at": now.Add(verificationGrace())}).Error
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Rotated JWT signing key", "kid", key.Kid, "alg", alg)
+	}
+
+	if err := config.DB.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Delete(&models.SigningKey{}).Error; err != nil {
+		return err
+	}
+	return kr.reload()
+}
+
+// sealStoredKeys encrypts keys stored before JWT_KEY_ENCRYPTION_KEY was set
+func sealStoredKeys() error {
+	if aead, err := keyCipher(); err != nil || aead == nil {
+		return err
+	}
+	var rows []models.SigningKey
+	if err := config.DB.Where("private_key NOT LIKE ?", sealedPrefix+"%").Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		sealed, err := sealPrivateKey([]byte(row.PrivateKey))
+		if err != nil {
+			return err
+		}
+		if err := config.DB.Model(&row).Update("private_key", sealed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitKeyRing loads (or creates) the signing keys and starts the rotation loop
+func InitKeyRing() error {
+	if os.Getenv("JWT_KEY_ENCRYPTION_KEY") == "" {
+		slog.Warn("JWT_KEY_ENCRYPTION_KEY is not set; signing keys are stored unencrypted")
+	}
+	if err := sealStoredKeys(); err != nil {
+		return err
+	}
+	if err := ring.rotate(false); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := ring.rotate(false); err != nil {
+				slog.Error("JWT key rotation failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// RotateSigningKey forces an immediate rotation regardless of key age
+func RotateSigningKey() error {
+	return ring.rotate(true)
+}
+
+func (kr *keyRing) signingKey() (*signingKey, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if kr.active == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return kr.active, nil
+}
+
+// verificationKey returns the public key for kid, reloading once (at most
+// every 10 seconds) when the kid was issued by another instance
+func (kr *keyRing) verificationKey(kid string) (*signingKey, error) {
+	kr.mu.RLock()
+	k, ok := kr.keys[kid]
+	stale := time.Since(kr.lastReload) > 10*time.Second
+	kr.mu.RUnlock()
+
+	if !ok && stale {
+		if err := kr.reload(); err != nil {
+			return nil, err
+		}
+		kr.mu.RLock()
+		k, ok = kr.keys[kid]
+		kr.mu.RUnlock()
+	}
+
+	if !ok || (k.expiresAt != nil && !k.expiresAt.After(time.Now())) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k, nil
+}
+
+func keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("missing kid header")
+	}
+	k, err := ring.verificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != k.alg {
+		return nil, errors.New("signing method does not match key")
+	}
+	return k.private.Public(), nil
+}
+
+// JWK is a public key in RFC 7517 format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns every public key currently valid for verification
+func JWKS() []JWK {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	jwks := []JWK{}
+	for _, k := range ring.keys {
+		jwk := JWK{Kid: k.kid, Use: "sig", Alg: k.alg}
+		switch pub := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
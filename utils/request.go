@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// trustedHops is the number of proxies in front of the app
+// (TRUSTED_PROXY_HOPS, default 1). Each appends the address it received the
+// request from to X-Forwarded-For.
+func trustedHops() int {
+	if n, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS")); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// ClientIP returns the caller's IP address. X-Forwarded-For / X-Real-IP are
+// only honoured when TRUST_PROXY=true, since clients can set them freely.
+// Entries left of those added by our own proxies are client-controlled, so
+// the address is counted from the right of X-Forwarded-For.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			entries := strings.Split(strings.Join(fwd, ","), ",")
+			i := len(entries) - trustedHops()
+			if i < 0 {
+				i = 0
+			}
+			return strings.TrimSpace(entries[i])
+		}
+		if real := r.Header.Get("X-Real-IP"); real != "" {
+			return strings.TrimSpace(real)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,163 @@
+// Package webhooks notifies registered endpoints of content events. Events
+// are written to a persistent delivery queue and sent by a background
+// worker with HMAC-signed payloads, retrying with exponential backoff.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"wwb99/config"
+	"wwb99/models"
+	"wwb99/security"
+)
+
+// Events that can be subscribed to. Subscriptions may also use wildcards
+// such as "news.*" or "*".
+var Events = []string{
+	"news.created", "news.updated", "news.deleted",
+	"highlight.created", "highlight.updated", "highlight.deleted", "highlight.reordered",
+	"sponsor.created", "sponsor.updated", "sponsor.deleted", "sponsor.reordered",
+	"footer.created", "footer.updated", "footer.deleted", "footer.reordered",
+	PingEvent,
+}
+
+// PingEvent is sent by the test endpoint only
+const PingEvent = "webhook.ping"
+
+// ValidEvent reports whether a subscription entry names a known event or a
+// wildcard covering one
+func ValidEvent(e string) bool {
+	for _, known := range Events {
+		if models.PermissionMatches(e, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// Envelope is the JSON body posted to webhooks
+type Envelope struct {
+	ID        string      `json:"id"` // same for every webhook receiving the event; use it to deduplicate
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Headers sent with each delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the X-Webhook-Signature value: "sha256=" and the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+// Receivers should recompute it, compare in constant time and reject old
+// timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a signing secret
+func NewSecret() (string, error) {
+	token, err := security.GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + token, nil
+}
+
+// Emit queues event for every active webhook subscribed to it. data is
+// the affected item (its state before deletion for *.deleted events).
+// Failures are logged: the change that triggered the event has already
+// been committed.
+func Emit(event string, data interface{}) {
+	var hooks []models.Webhook
+	if err := config.DB.Where("active = ?", true).Find(&hooks).Error; err != nil {
+		slog.Error("Failed to load webhooks", "event", event, "error", err)
+		return
+	}
+
+	var targets []models.Webhook
+	for _, h := range hooks {
+		if h.Subscribes(event) {
+			targets = append(targets, h)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if _, err := enqueue(event, data, targets); err != nil {
+		slog.Error("Failed to queue webhook deliveries", "event", event, "error", err)
+	}
+}
+
+// enqueue writes one delivery per webhook and wakes the worker
+func enqueue(event string, data interface{}, targets []models.Webhook) ([]models.WebhookDelivery, error) {
+	eventID, err := security.GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(Envelope{ID: "evt_" + eventID, Event: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, len(targets))
+	for i, h := range targets {
+		deliveries[i] = models.WebhookDelivery{
+			WebhookID:     h.ID,
+			EventID:       "evt_" + eventID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+		}
+	}
+	if err := config.DB.Create(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	wake()
+	return deliveries, nil
+}
+
+// Ping queues a webhook.ping event for one webhook regardless of its
+// subscriptions
+func Ping(h *models.Webhook) (*models.WebhookDelivery, error) {
+	deliveries, err := enqueue(PingEvent, map[string]interface{}{"webhook_id": h.ID, "name": h.Name}, []models.Webhook{*h})
+	if err != nil {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+// Redeliver queues a fresh copy of a delivery with the same event ID and
+// payload. The original and its attempt log are kept.
+func Redeliver(original *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	d := models.WebhookDelivery{
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+		RedeliveryOf:  &original.ID,
+	}
+	if err := config.DB.Create(&d).Error; err != nil {
+		return nil, err
+	}
+	wake()
+	return &d, nil
+}
@@ -0,0 +1,57 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		want      string
+	}{
+		{"ping", "whsec_test", 1700000000, body, "sha256=aa8efe37b751e71157c508c5ac4acb1e9fe5225db98355dfc00f4b680afbc447"},
+		{"other timestamp", "whsec_test", 1700000001, body, "sha256=1192acd5048f16b710d4929dd56544dab77162871e9ee4b727b2122f10dd4546"},
+		{"other secret", "other", 1700000000, body, "sha256=0b745d77e8146ca45a844ad89177fce05067c8ba592d8a848a1837088acdd617"},
+		{"empty body", "whsec_test", 0, nil, "sha256=a2fa7a43c6a1cf2e784eaf3327d65c65b3d2b790320ebed9aa5661bc42a8cccd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, tt.body); got != tt.want {
+				t.Fatalf("Sign = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		base time.Duration // before jitter
+	}{
+		{"first retry", 1, 30 * time.Second},
+		{"second retry", 2, time.Minute},
+		{"fifth retry", 5, 8 * time.Minute},
+		{"tenth retry", 10, 15360 * time.Second},
+		{"capped", 11, 6 * time.Hour},
+		{"overflow", 64, 6 * time.Hour},
+		{"infinite", 5000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ±20% jitter around the base delay
+			lo := time.Duration(float64(tt.base) * 0.8)
+			hi := time.Duration(float64(tt.base) * 1.2)
+			for i := 0; i < 200; i++ {
+				if d := Backoff(tt.n); d < lo || d > hi {
+					t.Fatalf("Backoff(%d) = %v, want within [%v, %v]", tt.n, d, lo, hi)
+				}
+			}
+		})
+	}
+}
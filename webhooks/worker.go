@@ -0,0 +1,253 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"wwb99/config"
+	"wwb99/models"
+
+	"gorm.io/gorm"
+)
+
+// Delivery settings
+const (
+	requestTimeout  = 10 * time.Second
+	lockDuration    = time.Minute // longer than a request can take
+	batchSize       = 20
+	maxResponseBody = 2048
+	backoffBase     = 30 * time.Second
+	backoffMax      = 6 * time.Hour
+)
+
+// MaxAttempts is how many times a delivery is tried before it is marked
+// failed (WEBHOOK_MAX_ATTEMPTS, default 8: about 2 hours of retries)
+func MaxAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		return n
+	}
+	return 8
+}
+
+// Backoff is the delay before retry n (1-based): 30s doubled each time,
+// capped at 6h, with ±20% jitter so failing endpoints aren't hit in bursts
+func Backoff(n int) time.Duration {
+	d := time.Duration(float64(backoffBase) * math.Pow(2, float64(n-1)))
+	if d > backoffMax || d <= 0 {
+		d = backoffMax
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(d) * jitter)
+}
+
+var errPrivateAddress = errors.New("webhook URL resolves to a private or loopback address")
+
+// allowPrivate permits endpoints on internal networks (WEBHOOK_ALLOW_PRIVATE)
+func allowPrivate() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+}
+
+// client refuses to connect to internal addresses unless allowed, checked
+// after DNS resolution so a public name can't point inside the network.
+// It never uses a proxy: the check would then see the proxy's address
+// rather than the endpoint's.
+var client = &http.Client{
+	Timeout: requestTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if allowPrivate() {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+					ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	// Redirects are not followed; a 3xx counts as a failure
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+var wakeup = make(chan struct{}, 1)
+
+// wake tells the worker new deliveries are due
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// StartWorker processes the delivery queue in the background, polling
+// every interval and immediately when events are queued
+func StartWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for processDue() == batchSize {
+				// Keep draining a full queue
+			}
+			select {
+			case <-ticker.C:
+			case <-wakeup:
+			}
+		}
+	}()
+}
+
+// processDue sends one batch of due deliveries and returns how many it
+// claimed
+func processDue() int {
+	now := time.Now()
+	var due []models.WebhookDelivery
+	err := config.DB.Where("status = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until < ?)",
+		models.DeliveryPending, now, now).
+		Order("next_attempt_at ASC, id ASC").Limit(batchSize).Find(&due).Error
+	if err != nil {
+		slog.Error("Failed to load webhook deliveries", "error", err)
+		return 0
+	}
+
+	claimed := 0
+	for i := range due {
+		d := &due[i]
+		// Claim the row; another instance may have taken it meanwhile. The
+		// batch can take minutes to send, so the lock runs from now, not
+		// from when the batch was loaded
+		now := time.Now()
+		res := config.DB.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND (locked_until IS NULL OR locked_until < ?)", d.ID, models.DeliveryPending, now).
+			Update("locked_until", now.Add(lockDuration))
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		claimed++
+		attempt(d)
+	}
+	return claimed
+}
+
+// attempt sends a delivery once and records the outcome
+func attempt(d *models.WebhookDelivery) {
+	var hook models.Webhook
+	if err := config.DB.First(&hook, d.WebhookID).Error; err != nil {
+		// The webhook was deleted; nothing left to deliver to
+		finish(d, models.WebhookAttempt{Error: "webhook no longer exists"}, true)
+		return
+	}
+	if !hook.Active && d.Event != PingEvent {
+		finish(d, models.WebhookAttempt{Error: "webhook is disabled"}, true)
+		return
+	}
+
+	log := models.WebhookAttempt{}
+	start := time.Now()
+	status, body, err := send(&hook, d)
+	log.DurationMs = time.Since(start).Milliseconds()
+	log.StatusCode = status
+	log.ResponseBody = body
+	if err != nil {
+		log.Error = err.Error()
+	} else if status < 200 || status > 299 {
+		log.Error = fmt.Sprintf("endpoint answered %d", status)
+	}
+	finish(d, log, false)
+}
+
+func send(hook *models.Webhook, d *models.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wwb99-webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, validUTF8(snippet), nil
+}
+
+// validUTF8 keeps a truncated response storable in a text column
+func validUTF8(b []byte) string {
+	for len(b) > 0 && !utf8.Valid(b) {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+// finish logs the attempt and schedules a retry or settles the delivery.
+// final settles it as failed without retrying.
+func finish(d *models.WebhookDelivery, log models.WebhookAttempt, final bool) {
+	now := time.Now()
+	d.Attempts++
+	log.DeliveryID = d.ID
+	log.Attempt = d.Attempts
+
+	updates := map[string]interface{}{
+		"attempts":        d.Attempts,
+		"last_attempt_at": now,
+		"response_status": log.StatusCode,
+		"last_error":      log.Error,
+		"locked_until":    nil,
+	}
+	switch {
+	case log.Error == "":
+		updates["status"] = models.DeliverySucceeded
+	case final || d.Attempts >= MaxAttempts():
+		updates["status"] = models.DeliveryFailed
+	default:
+		updates["next_attempt_at"] = now.Add(Backoff(d.Attempts))
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&log).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id = ?", d.ID).Updates(updates).Error
+	})
+	if err != nil {
+		slog.Error("Failed to record webhook attempt", "delivery_id", d.ID, "error", err)
+	}
+}